@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/agent"
+	"github.com/atomisadev/cloak/pkg/crypto"
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	agentIdle       time.Duration
+	agentSocket     string
+	agentForeground bool
+	agentUnlockIdle time.Duration
+)
+
+const agentStartTimeout = 3 * time.Second
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Start an agent that keeps vault keys unlocked, like ssh-agent",
+	Long: `Starts a background agent and prints the shell command that points cloak at it:
+
+  eval "$(cloak agent)"
+
+While CLOAK_AGENT_SOCK is set, cloak asks the agent for the vault key before
+going to the keychain (CLOAK_MASTER_KEY still wins), and keys it finds
+elsewhere are handed to the agent, so the keychain or passphrase prompt
+only appears once. Keys are kept in locked memory that is never swapped out,
+and are forgotten after --idle without use.
+
+The socket is only accessible to you, and the agent checks that every
+connecting process runs as your user.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if agentForeground {
+			serveAgent()
+			return
+		}
+
+		// stdout is for the shell
+		color.Output = os.Stderr
+
+		if c, ok := agent.FromEnv(); ok {
+			if st, err := c.Status(); err == nil {
+				color.Yellow("An agent is already running (pid %d).", st.PID)
+				printAgentEnv(c.Path)
+				return
+			}
+		}
+
+		path := agentSocket
+		if path == "" {
+			dir, err := os.MkdirTemp("", "cloak-agent-")
+			if err != nil {
+				color.Red("Failed to create socket directory: %v", err)
+				os.Exit(1)
+			}
+			path = filepath.Join(dir, "agent.sock")
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			color.Red("Failed to start agent: %v", err)
+			os.Exit(1)
+		}
+		daemon := exec.Command(exe, "agent", "--foreground", "--socket", path, "--idle", agentIdle.String())
+		daemon.SysProcAttr = detachedProcAttr()
+		if err := daemon.Start(); err != nil {
+			color.Red("Failed to start agent: %v", err)
+			os.Exit(1)
+		}
+		daemon.Process.Release()
+
+		c := &agent.Client{Path: path}
+		deadline := time.Now().Add(agentStartTimeout)
+		for {
+			st, err := c.Status()
+			if err == nil {
+				color.Green("✔ Agent started (pid %d).", st.PID)
+				break
+			}
+			if time.Now().After(deadline) {
+				color.Red("Agent didn't come up: %v", err)
+				os.Exit(1)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		printAgentEnv(path)
+	},
+}
+
+var agentUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Hand the key of this project's vault to the agent",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := requireAgent()
+		hdr := requireHeader()
+
+		key := RequireKey()
+		raw, _ := hex.DecodeString(key)
+		if crypto.KeyID(raw) != hdr.KeyID {
+			color.Red("✖ Error: the key found doesn't open this vault.")
+			os.Exit(1)
+		}
+
+		wd, _ := os.Getwd()
+		if err := c.Add(hdr.KeyID, key, wd, agentUnlockIdle); err != nil {
+			color.Red("Failed to add key: %v", err)
+			os.Exit(1)
+		}
+		color.Green("✔ Key %s handed to the agent.", hdr.KeyID)
+	},
+}
+
+var agentLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Make the agent forget all keys",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := requireAgent().Lock(); err != nil {
+			color.Red("Failed to lock agent: %v", err)
+			os.Exit(1)
+		}
+		color.Green("✔ Agent locked. All keys were wiped.")
+	},
+}
+
+var agentStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the agent and the keys it holds",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := requireAgent()
+		st, err := c.Status()
+		if err != nil {
+			color.Red("✖ Error: agent at %s is not responding: %v", c.Path, err)
+			os.Exit(1)
+		}
+
+		idle := "never"
+		if st.Idle > 0 {
+			idle = st.Idle.String()
+		}
+		fmt.Printf("Agent pid %d at %s (keys expire after %s idle)\n", st.PID, c.Path, idle)
+		if len(st.Keys) == 0 {
+			color.New(color.FgHiBlack).Println("No keys. Run 'cloak agent unlock' in a project.")
+			return
+		}
+
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY ID\tVAULT\tADDED\tEXPIRES")
+		for _, k := range st.Keys {
+			expires := "-"
+			if !k.Expires.IsZero() {
+				expires = "in " + time.Until(k.Expires).Round(time.Second).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.KeyID, dash(k.Label), formatTime(k.Added), expires)
+		}
+		w.Flush()
+	},
+}
+
+var agentStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the agent, wiping its keys",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := requireAgent().Stop(); err != nil {
+			color.Red("Failed to stop agent: %v", err)
+			os.Exit(1)
+		}
+		color.Green("✔ Agent stopped.")
+		color.New(color.FgHiBlack).Printf("  Run 'unset %s' to stop pointing cloak at it.\n", agent.SocketEnv)
+	},
+}
+
+// the agent process itself
+func serveAgent() {
+	if agentSocket == "" {
+		color.Red("Error: --foreground needs --socket.")
+		os.Exit(1)
+	}
+
+	l, err := agent.Listen(agentSocket)
+	if err != nil {
+		color.Red("Failed to listen on %s: %v", agentSocket, err)
+		os.Exit(1)
+	}
+
+	srv := agent.NewServer(agentIdle)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		srv.Close()
+	}()
+
+	err = srv.Serve(l)
+	// we made the directory for the socket, so we clean it up too
+	if strings.HasPrefix(filepath.Base(filepath.Dir(agentSocket)), "cloak-agent-") {
+		os.Remove(filepath.Dir(agentSocket))
+	}
+	if err != nil {
+		color.Red("Agent failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+func printAgentEnv(path string) {
+	quoted := "'" + strings.ReplaceAll(path, "'", `'"'"'`) + "'"
+	fmt.Printf("%s=%s; export %s;\n", agent.SocketEnv, quoted, agent.SocketEnv)
+}
+
+func requireAgent() *agent.Client {
+	c, ok := agent.FromEnv()
+	if !ok {
+		color.Red("✖ Error: %s is not set.", agent.SocketEnv)
+		color.Yellow(`  Start an agent with: eval "$(cloak agent)"`)
+		os.Exit(1)
+	}
+	return c
+}
+
+// the vault key from the agent, if one is running and holds it
+func agentKey() (string, bool) {
+	c, ok := agent.FromEnv()
+	if !ok {
+		return "", false
+	}
+	hdr, err := store.ReadHeader("cloak.encrypted")
+	if err != nil {
+		return "", false
+	}
+
+	key, err := c.Get(hdr.KeyID)
+	if err != nil {
+		if !errors.Is(err, agent.ErrNoKey) {
+			color.Yellow("⚠ cloak agent at %s is not reachable: %v", c.Path, err)
+		}
+		return "", false
+	}
+	return key, true
+}
+
+// hands a key found in the keychain (or typed in) to the agent, so the
+// next command doesn't have to go there again
+func offerToAgent(key string) {
+	c, ok := agent.FromEnv()
+	if !ok {
+		return
+	}
+	hdr, err := store.ReadHeader("cloak.encrypted")
+	if err != nil {
+		return
+	}
+	raw, err := hex.DecodeString(key)
+	if err != nil || crypto.KeyID(raw) != hdr.KeyID {
+		return
+	}
+
+	wd, _ := os.Getwd()
+	c.Add(hdr.KeyID, key, wd, 0)
+}
+
+func init() {
+	agentCmd.Flags().DurationVar(&agentIdle, "idle", 15*time.Minute, "forget keys unused for this long (0 keeps them until locked)")
+	agentCmd.Flags().StringVar(&agentSocket, "socket", "", "socket path (default: a new private temp directory)")
+	agentCmd.Flags().BoolVar(&agentForeground, "foreground", false, "run the agent in this process instead of in the background")
+
+	agentUnlockCmd.Flags().DurationVar(&agentUnlockIdle, "idle", 0, "idle timeout for this key (default: the agent's)")
+
+	agentCmd.AddCommand(agentUnlockCmd, agentLockCmd, agentStatusCmd, agentStopCmd)
+	rootCmd.AddCommand(agentCmd)
+}
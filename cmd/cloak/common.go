@@ -1,31 +1,309 @@
 package main
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"os/user"
+	"strings"
+	"time"
 
+	"github.com/atomisadev/cloak/pkg/crypto"
+	"github.com/atomisadev/cloak/pkg/injector"
 	"github.com/atomisadev/cloak/pkg/keychain"
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/charmbracelet/x/term"
 	"github.com/fatih/color"
 )
 
-func RequireKey() string {
-	if envKey := os.Getenv("CLOAK_MASTER_KEY"); envKey != "" {
-		return envKey
+var envFlag string
+
+// environment selected with --env or CLOAK_ENV
+func currentEnv() string {
+	if envFlag != "" {
+		return envFlag
+	}
+	if env := os.Getenv("CLOAK_ENV"); env != "" {
+		return env
 	}
+	return store.DefaultEnv
+}
 
-	wd, err := os.Getwd()
-	if err == nil {
-		if key, err := keychain.Get(wd); err == nil && key != "" {
+// how long a mutator waits for another cloak process to finish writing
+const vaultLockTimeout = 30 * time.Second
+
+// takes the vault's advisory lock so parallel mutators serialize instead of
+// overwriting each other's changes. take it before loading the vault and
+// release it (defer lockVault()()) after saving
+func lockVault() func() {
+	lock, err := store.LockFile("cloak.encrypted", vaultLockTimeout)
+	if errors.Is(err, store.ErrLocked) {
+		color.Red("✖ Error: cloak.encrypted is being modified by another cloak process.")
+		color.Yellow("  Gave up after %s. Try again once it has finished.", vaultLockTimeout)
+		os.Exit(1)
+	} else if err != nil {
+		color.Red("Failed to lock store: %v", err)
+		os.Exit(1)
+	}
+	return func() { lock.Unlock() }
+}
+
+func loadVault(masterKey string) *store.Vault {
+	vault, err := store.Load("cloak.encrypted", masterKey)
+	if err != nil {
+		color.Red("Failed to load store: %v", err)
+		os.Exit(1)
+	}
+	return vault
+}
+
+// who gets recorded as the last modifier of a secret: the git identity
+// when there is one, otherwise the OS user
+func currentAuthor() string {
+	for _, key := range []string{"user.email", "user.name"} {
+		if out, err := gitOutput("config", key); err == nil {
+			if name := strings.TrimSpace(string(out)); name != "" {
+				return name
+			}
+		}
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+// flattened secrets of an environment with the ${KEY} references of keys
+// (all of them when nil) expanded, or as stored when raw is set
+func resolveSecrets(vault *store.Vault, envName string, raw bool, keys []string) map[string]string {
+	secrets, err := vault.Resolve(envName)
+	if err != nil {
+		color.Red("Failed to resolve environment: %v", err)
+		os.Exit(1)
+	}
+	if raw {
+		return secrets
+	}
+
+	var expanded map[string]string
+	if keys == nil {
+		expanded, err = injector.Expand(secrets)
+	} else {
+		expanded, err = injector.ExpandKeys(secrets, keys)
+	}
+	if err != nil {
+		color.Red("✖ Error: %v", err)
+		os.Exit(1)
+	}
+	return expanded
+}
+
+// looks up an environment and unlocks it (and everything it inherits from)
+// when it is sealed with its own key
+func requireEnv(vault *store.Vault, name string) *store.Environment {
+	chain, err := vault.Chain(name)
+	if err != nil {
+		color.Red("✖ Error: %v", err)
+		color.Yellow("  Available environments: %s", strings.Join(vault.EnvNames(), ", "))
+		os.Exit(1)
+	}
+
+	for _, n := range chain {
+		env, _ := vault.Env(n)
+		if !env.Locked() {
+			continue
+		}
+
+		key := envKey(n)
+		if key == "" {
+			color.Red("✖ Error: environment '%s' is sealed with its own key.", n)
+			color.Yellow("  Set 'export CLOAK_ENV_KEY=...' to unlock it.")
+			os.Exit(1)
+		}
+		if err := env.Unlock(key); err != nil {
+			color.Red("Failed to unlock environment '%s': %v", n, err)
+			os.Exit(1)
+		}
+	}
+
+	env, _ := vault.Env(name)
+	return env
+}
+
+// key for an environment sealed with its own key: CLOAK_ENV_KEY applies to
+// the selected environment, otherwise the project keychain is asked
+func envKey(name string) string {
+	if name == currentEnv() {
+		if key := os.Getenv("CLOAK_ENV_KEY"); key != "" {
 			return key
 		}
 	}
 
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	key, _ := keychain.GetEnvKey(wd, name)
+	return key
+}
+
+func RequireKey() string {
+	if key, ok := lookupKey(); ok {
+		return key
+	}
+
 	color.Red("✖ Error: Master Key not found.")
 	color.New(color.FgHiBlack).Println("  Cloak cannot decrypt your secrets without the key.")
 	fmt.Println()
 	color.Yellow("  Solution 1: Run 'cloak init' to generate and save a key.")
 	color.Yellow("  Solution 2: Set 'export CLOAK_MASTER_KEY=...' manually.")
+	if hdr, err := store.ReadHeader("cloak.encrypted"); err == nil && hdr.KDF != nil {
+		color.Yellow("  Solution 3: Run cloak from a terminal to enter the vault passphrase.")
+	}
 
 	os.Exit(1)
 	return ""
 }
+
+// tries every key source in order: env var, agent, project keychain,
+// recipient identity, then a passphrase prompt
+func lookupKey() (string, bool) {
+	if envKey := os.Getenv("CLOAK_MASTER_KEY"); envKey != "" {
+		return resolveRotatedKey(envKey), true
+	}
+
+	if key, ok := agentKey(); ok {
+		return key, true
+	}
+
+	key, ok := storedKey()
+	if ok {
+		offerToAgent(key)
+	}
+	return key, ok
+}
+
+func storedKey() (string, bool) {
+	wd, err := os.Getwd()
+	if err == nil {
+		if key, err := keychain.Get(wd); err == nil && key != "" {
+			return resolveRotatedKey(key), true
+		}
+	}
+
+	if key, ok := identityKey(); ok {
+		return key, true
+	}
+
+	return promptPassphraseKey()
+}
+
+// swaps a master key retired by 'cloak rotate --grace' for the current one.
+// keys that can't be resolved are returned unchanged so the usual
+// decryption error is reported
+func resolveRotatedKey(key string) string {
+	hdr, err := store.ReadHeader("cloak.encrypted")
+	if err != nil {
+		return key
+	}
+
+	current, grace, err := hdr.ResolveKey(key)
+	if err != nil {
+		if !errors.Is(err, store.ErrKeyMismatch) {
+			color.Yellow("⚠ %v", err)
+		}
+		return key
+	}
+	if grace != nil {
+		color.Yellow("⚠ This master key was rotated and stops working %s.", grace.Expires.Local().Format(time.RFC1123))
+		color.Yellow("  Update CLOAK_MASTER_KEY / your keychain with the new key.")
+	}
+	return current
+}
+
+// unwraps the vault key with the user's identity if they were added
+// via 'cloak recipients add'
+func identityKey() (string, bool) {
+	hdr, err := store.ReadHeader("cloak.encrypted")
+	if err != nil || len(hdr.Recipients) == 0 {
+		return "", false
+	}
+
+	identity, err := keychain.GetIdentity()
+	if err != nil || identity == "" {
+		return "", false
+	}
+
+	key, err := hdr.UnwrapKey(identity)
+	if err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// derives the key from the vault passphrase if the vault was created with
+// 'cloak init --passphrase' and there is a terminal to prompt on
+func promptPassphraseKey() (string, bool) {
+	hdr, err := store.ReadHeader("cloak.encrypted")
+	if err != nil || hdr.KDF == nil || !term.IsTerminal(os.Stdin.Fd()) {
+		return "", false
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		passphrase, err := readPassphrase("Vault passphrase: ")
+		if err != nil {
+			return "", false
+		}
+
+		key, err := crypto.DeriveKey(passphrase, hdr.KDF)
+		if err != nil {
+			color.Red("Failed to derive key: %v", err)
+			os.Exit(1)
+		}
+
+		raw, _ := hex.DecodeString(key)
+		if crypto.KeyID(raw) == hdr.KeyID {
+			return key, true
+		}
+		color.Red("✖ Wrong passphrase.")
+	}
+
+	os.Exit(1)
+	return "", false
+}
+
+// asks for a new passphrase twice and enforces a minimum length
+func promptNewPassphrase() string {
+	passphrase, err := readPassphrase("Choose a vault passphrase: ")
+	if err != nil {
+		color.Red("Failed to read passphrase: %v", err)
+		os.Exit(1)
+	}
+	if len(passphrase) < 12 {
+		color.Red("Error: passphrase must be at least 12 characters.")
+		os.Exit(1)
+	}
+
+	confirm, err := readPassphrase("Confirm passphrase: ")
+	if err != nil {
+		color.Red("Failed to read passphrase: %v", err)
+		os.Exit(1)
+	}
+	if confirm != passphrase {
+		color.Red("Error: passphrases do not match.")
+		os.Exit(1)
+	}
+
+	return passphrase
+}
+
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(passphrase), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/sharing"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dropAddr      string
+	dropStorage   string
+	dropDir       string
+	dropMaxSize   int64
+	dropMaxTTL    time.Duration
+	dropMaxDrops  int
+	dropMaxTotal  int64
+	dropPublicURL string
+)
+
+var dropServerCmd = &cobra.Command{
+	Use:   "drop-server",
+	Short: "Run a self-hosted dead drop server for 'cloak share'",
+	Long: `Serves a file.io compatible API so 'cloak share' never has to leave your network:
+
+  cloak drop-server --addr :8080 --storage disk --dir /var/lib/cloak-drops
+  cloak share --endpoint https://drops.internal.example.com
+
+Drops are deleted on their first download or once they expire, whichever comes
+first. Once --max-drops or --max-total is reached new uploads are refused with
+507 Insufficient Storage until drops are claimed or expire. The server only ever
+sees ciphertext; put it behind TLS all the same.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dropMaxSize <= 0 {
+			color.Red("Error: --max-size must be greater than zero.")
+			os.Exit(1)
+		}
+		if dropMaxTTL <= 0 {
+			color.Red("Error: --max-ttl must be greater than zero.")
+			os.Exit(1)
+		}
+		if dropMaxDrops < 0 || dropMaxTotal < 0 {
+			color.Red("Error: --max-drops and --max-total can't be negative.")
+			os.Exit(1)
+		}
+		limits := sharing.DropLimits{MaxDrops: dropMaxDrops, MaxBytes: dropMaxTotal}
+
+		var dropStore sharing.DropStore
+		switch dropStorage {
+		case "memory":
+			s := sharing.NewMemoryStore()
+			s.Limits = limits
+			dropStore = s
+		case "disk":
+			s, err := sharing.NewDiskStore(dropDir)
+			if err != nil {
+				color.Red("Failed to open storage directory: %v", err)
+				os.Exit(1)
+			}
+			s.Limits = limits
+			dropStore = s
+		default:
+			color.Red("Error: unknown storage '%s' (use memory or disk).", dropStorage)
+			os.Exit(1)
+		}
+
+		server := sharing.NewDropServer(dropStore, sharing.DropServerOptions{
+			MaxSize:   dropMaxSize,
+			MaxTTL:    dropMaxTTL,
+			PublicURL: dropPublicURL,
+		})
+
+		go func() {
+			for range time.Tick(time.Minute) {
+				if err := dropStore.Sweep(time.Now()); err != nil {
+					log.Printf("drop-server: sweep: %v", err)
+				}
+			}
+		}()
+
+		color.Green("✔ Drop server listening on %s (%s storage)", dropAddr, dropStorage)
+		fmt.Println("Point clients at it with: cloak share --endpoint <url>")
+
+		httpServer := &http.Server{
+			Addr:              dropAddr,
+			Handler:           server.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+		}
+		if err := httpServer.ListenAndServe(); err != nil {
+			color.Red("Server stopped: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	dropServerCmd.Flags().StringVar(&dropAddr, "addr", ":8080", "address to listen on")
+	dropServerCmd.Flags().StringVar(&dropStorage, "storage", "memory", "where to keep drops: memory or disk")
+	dropServerCmd.Flags().StringVar(&dropDir, "dir", "cloak-drops", "directory for --storage disk")
+	dropServerCmd.Flags().Int64Var(&dropMaxSize, "max-size", 64<<10, "largest accepted drop in bytes")
+	dropServerCmd.Flags().DurationVar(&dropMaxTTL, "max-ttl", 24*time.Hour, "longest a drop may live")
+	dropServerCmd.Flags().IntVar(&dropMaxDrops, "max-drops", 10000, "most drops held at once (0 for no limit)")
+	dropServerCmd.Flags().Int64Var(&dropMaxTotal, "max-total", 256<<20, "most bytes held across all drops (0 for no limit)")
+	dropServerCmd.Flags().StringVar(&dropPublicURL, "public-url", "", "base URL for returned links (default: the request host)")
+
+	rootCmd.AddCommand(dropServerCmd)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/atomisadev/cloak/internal/ui"
 	"github.com/atomisadev/cloak/pkg/store"
@@ -17,14 +18,12 @@ var editCmd = &cobra.Command{
 	Long:  `Launch the interactive spreadsheet editor for your secrets.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		masterKey := RequireKey()
+		defer lockVault()()
 
-		secrets, err := store.Load("cloak.encrypted", masterKey)
-		if err != nil {
-			color.Red("Failed to load store: %v", err)
-			os.Exit(1)
-		}
+		vault := loadVault(masterKey)
+		env := requireEnv(vault, currentEnv())
 
-		p := tea.NewProgram(ui.InitialModel(secrets), tea.WithAltScreen())
+		p := tea.NewProgram(ui.InitialModel(env), tea.WithAltScreen())
 
 		finalModel, err := p.Run()
 		if err != nil {
@@ -38,7 +37,8 @@ var editCmd = &cobra.Command{
 		}
 
 		if m.ToSave != nil {
-			if err := store.Save("cloak.encrypted", m.ToSave, masterKey); err != nil {
+			env.Replace(m.ToSave, currentAuthor(), time.Now().UTC())
+			if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
 				color.Red("Failed to save store: %v", err)
 				os.Exit(1)
 			}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+	"github.com/atomisadev/cloak/pkg/keychain"
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	envInherits string
+	envOwnKey   bool
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage named environments (dev, staging, prod, ...)",
+	Long: `A vault holds one or more named environments. Pick one with --env or CLOAK_ENV
+on any command; without either, 'default' is used.
+
+An environment can inherit from another and override some of its keys, and can be
+sealed with its own key so that holders of the master key alone can't read it.`,
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the environments in the vault",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		vault := loadVault(RequireKey())
+		selected := currentEnv()
+
+		for _, name := range vault.EnvNames() {
+			env, _ := vault.Env(name)
+			if env.Locked() {
+				if key := envKey(name); key != "" {
+					_ = env.Unlock(key)
+				}
+			}
+
+			details := ""
+			if env.Inherits != "" {
+				details += fmt.Sprintf(" ← %s", env.Inherits)
+			}
+			switch {
+			case env.Locked():
+				details += " [sealed, locked]"
+			case env.KeyID != "":
+				details += fmt.Sprintf(" [sealed] %d keys", len(env.Secrets))
+			default:
+				details += fmt.Sprintf(" %d keys", len(env.Secrets))
+			}
+
+			if name == selected {
+				color.Cyan("* %s%s", name, details)
+				continue
+			}
+			fmt.Printf("  %s%s\n", name, details)
+		}
+	},
+}
+
+var envCreateCmd = &cobra.Command{
+	Use:   "create [NAME]",
+	Short: "Add a new environment",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+
+		masterKey := RequireKey()
+		defer lockVault()()
+		vault := loadVault(masterKey)
+
+		var envKeyHex string
+		if envOwnKey {
+			var err error
+			envKeyHex, err = crypto.GenerateKey()
+			if err != nil {
+				color.Red("Failed to generate key: %v", err)
+				os.Exit(1)
+			}
+		}
+
+		if _, err := vault.CreateEnv(name, envInherits, envKeyHex); err != nil {
+			color.Red("Error: %v", err)
+			os.Exit(1)
+		}
+
+		if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
+			color.Red("Failed to save store: %v", err)
+			os.Exit(1)
+		}
+
+		color.Green("✔ Created environment %s", name)
+		if envKeyHex == "" {
+			return
+		}
+
+		fmt.Printf("Here is the key for '%s'. Only people with it can read its secrets:\n", name)
+		fmt.Println()
+		color.New(color.FgGreen, color.Bold).Println(envKeyHex)
+		fmt.Println()
+
+		wd, _ := os.Getwd()
+		if err := keychain.SaveEnvKey(wd, name, envKeyHex); err == nil {
+			color.Cyan("Environment key saved to System Keychain.")
+		} else {
+			color.Yellow("⚠ Could not save to Keychain: %v", err)
+			fmt.Println("Set it manually: export CLOAK_ENV_KEY=...")
+		}
+	},
+}
+
+var envDeleteCmd = &cobra.Command{
+	Use:   "delete [NAME]",
+	Short: "Remove an environment and all of its secrets",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		masterKey := RequireKey()
+		defer lockVault()()
+		vault := loadVault(masterKey)
+
+		if err := vault.DeleteEnv(args[0]); err != nil {
+			color.Red("Error: %v", err)
+			os.Exit(1)
+		}
+
+		if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
+			color.Red("Failed to save store: %v", err)
+			os.Exit(1)
+		}
+
+		color.Cyan("✔ Deleted environment %s", args[0])
+	},
+}
+
+func init() {
+	envCreateCmd.Flags().StringVar(&envInherits, "inherits", "", "environment to inherit keys from")
+	envCreateCmd.Flags().BoolVar(&envOwnKey, "own-key", false, "seal the environment with its own key")
+
+	envCmd.AddCommand(envListCmd)
+	envCmd.AddCommand(envCreateCmd)
+	envCmd.AddCommand(envDeleteCmd)
+
+	rootCmd.AddCommand(envCmd)
+}
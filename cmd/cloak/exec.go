@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"github.com/atomisadev/cloak/pkg/injector"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec -- [COMMAND]",
+	Short: "Replace cloak with a command that has secrets injected",
+	Long: `Like 'cloak run', but cloak replaces itself with the command (execve) instead
+of starting it as a child. The command keeps cloak's PID, so in a container
+it becomes PID 1 and receives signals from the runtime directly:
+
+  ENTRYPOINT ["cloak", "exec", "--"]
+  CMD ["node", "server.js"]
+
+The filtering flags and --file work the same as for 'cloak run'. Features that
+need cloak to keep running next to the command, like --redact, are only
+available with 'cloak run'.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets := prepareInjection(args)
+
+		// only returns if the exec failed
+		err := injector.Exec(args, secrets, runOpts)
+		color.Red("Command execution failed: %v", err)
+		os.Exit(1)
+	},
+}
+
+func init() {
+	addInjectionFlags(execCmd)
+
+	rootCmd.AddCommand(execCmd)
+}
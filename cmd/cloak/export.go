@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+
+	"github.com/atomisadev/cloak/pkg/envfile"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat string
+	exportOut    string
+	exportRaw    bool
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Print the selected environment as dotenv, JSON, YAML or shell exports",
+	Long: `Writes the resolved secrets of the selected environment (including inherited
+keys) in plaintext, for tools that can't be wrapped with 'cloak run':
+
+  cloak export --format dotenv -o .env.local
+  eval "$(cloak export --format shell-export)"
+
+${KEY} references are expanded unless --raw is given.
+Prefer 'cloak run' whenever you can; exported files are not protected by cloak.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// stdout may be piped into another tool
+		color.Output = os.Stderr
+
+		vault := loadVault(RequireKey())
+		envName := currentEnv()
+		requireEnv(vault, envName)
+
+		secrets := resolveSecrets(vault, envName, exportRaw, nil)
+
+		out, err := envfile.Format(exportFormat, secrets)
+		if err != nil {
+			color.Red("Failed to export: %v", err)
+			os.Exit(1)
+		}
+
+		if exportOut == "" {
+			os.Stdout.Write(out)
+			return
+		}
+		if err := os.WriteFile(exportOut, out, 0600); err != nil {
+			color.Red("Failed to write %s: %v", exportOut, err)
+			os.Exit(1)
+		}
+		color.Green("✔ Exported %d secrets to %s", len(secrets), exportOut)
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportFormat, "format", "dotenv", "output format: dotenv, json, yaml or shell-export")
+	exportCmd.Flags().BoolVar(&exportRaw, "raw", false, "don't expand ${KEY} references")
+	exportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "write to a file (mode 0600) instead of stdout")
+
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var getRaw bool
+
+var getCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print the value of a secret",
+	Long: `Prints the value of KEY in the selected environment (including inherited keys),
+for use in scripts:
+
+  DB_URL=$(cloak get DB_URL)
+  cloak get DB_URL --json
+  cloak get DB_URL --format '{{.Value}} (set by {{.ModifiedBy}})'
+
+${KEY} references are expanded; --raw prints the value as stored.
+Exits with status 2 when the key doesn't exist, 1 on any other error.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// stdout carries the value only
+		color.Output = os.Stderr
+
+		key := args[0]
+		vault := loadVault(RequireKey())
+		envName := currentEnv()
+		requireEnv(vault, envName)
+
+		secrets := resolveSecrets(vault, envName, getRaw, []string{key})
+		value, ok := secrets[key]
+		if !ok {
+			color.Red("✖ Error: %s is not set in '%s'.", key, envName)
+			os.Exit(exitKeyNotFound)
+		}
+
+		meta, err := vault.ResolveMeta(envName)
+		if err != nil {
+			color.Red("Failed to resolve environment: %v", err)
+			os.Exit(1)
+		}
+
+		if printEntries([]secretEntry{newSecretEntry(key, &value, meta[key])}, true) {
+			return
+		}
+		fmt.Println(value)
+	},
+}
+
+func init() {
+	addOutputFlags(getCmd)
+	getCmd.Flags().BoolVar(&getRaw, "raw", false, "don't expand ${KEY} references")
+
+	rootCmd.AddCommand(getCmd)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var gitCmd = &cobra.Command{
+	Use:   "git",
+	Short: "Git integration for cloak.encrypted",
+}
+
+var gitInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Register cloak as the merge and diff driver for cloak.encrypted",
+	Long: `Configures this repository so that 'git merge' resolves cloak.encrypted with
+'cloak fix-merge' instead of reporting a binary conflict, and 'git diff' shows which
+keys changed (via 'cloak git textconv').
+
+This writes the driver to .git/config and adds an entry to .gitattributes (commit that file).`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		root, err := gitOutput("rev-parse", "--show-toplevel")
+		if err != nil {
+			color.Red("Error: not inside a git repository.")
+			os.Exit(1)
+		}
+
+		settings := [][]string{
+			{"merge.cloak.name", "cloak vault merge"},
+			{"merge.cloak.driver", "cloak fix-merge --driver %O %A %B %P"},
+			{"diff.cloak.textconv", "cloak git textconv"},
+		}
+		for _, kv := range settings {
+			if _, err := gitOutput("config", kv[0], kv[1]); err != nil {
+				color.Red("Failed to configure git: %v", err)
+				os.Exit(1)
+			}
+		}
+
+		attrPath := filepath.Join(strings.TrimSpace(string(root)), ".gitattributes")
+		if err := ensureGitAttributes(attrPath, "cloak.encrypted", "-text", "merge=cloak", "diff=cloak"); err != nil {
+			color.Red("Failed to update .gitattributes: %v", err)
+			os.Exit(1)
+		}
+
+		color.Green("✔ Git merge and diff drivers installed.")
+		color.New(color.FgHiBlack).Println("Commit .gitattributes so the rest of the team picks it up (each clone still needs 'cloak git install').")
+	},
+}
+
+var textconvReveal bool
+
+var gitTextconvCmd = &cobra.Command{
+	Use:   "textconv [FILE]",
+	Short: "Print a vault as stable, diffable text (used by git diff)",
+	Long: `Decrypts the given vault and prints one line per key, sorted by environment and key.
+Values are replaced by a keyed hash so reviewers can see that a value changed without
+seeing it. Use --reveal to print the real values, e.g. for a one-off review:
+
+  git -c diff.cloak.textconv="cloak git textconv --reveal" diff`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// git shows whatever we print as the file's content, so keep warnings out of it
+		color.Output = os.Stderr
+
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			color.Red("Failed to read %s: %v", args[0], err)
+			os.Exit(1)
+		}
+
+		masterKey, ok := lookupKey()
+		if !ok {
+			fmt.Println("# cloak vault: no master key available, contents hidden")
+			return
+		}
+
+		vault, err := store.Decode(data, masterKey)
+		if err != nil {
+			fmt.Printf("# cloak vault: cannot decrypt (%v)\n", err)
+			return
+		}
+		unlockAvailableEnvs(vault)
+
+		printTextconv(data, vault, masterKey)
+	},
+}
+
+func printTextconv(data []byte, vault *store.Vault, masterKey string) {
+	mac := hmac.New(sha256.New, []byte(masterKey))
+	mask := func(env, key, value string) string {
+		if textconvReveal {
+			return strconv.Quote(value)
+		}
+		mac.Reset()
+		mac.Write([]byte(env + "\x00" + key + "\x00" + value))
+		return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+	}
+
+	if hdr, err := store.ParseHeader(data); err == nil {
+		fmt.Printf("# cloak vault v%d\n", hdr.Version)
+		for _, r := range hdr.Recipients {
+			fmt.Printf("# recipient %s %s\n", r.Name, r.PublicKey)
+		}
+		for _, g := range hdr.Grace {
+			fmt.Printf("# grace key %s until %s\n", g.KeyID, g.Expires.Format(time.RFC3339))
+		}
+	} else {
+		fmt.Println("# cloak vault (legacy format)")
+	}
+
+	for _, name := range vault.EnvNames() {
+		env, _ := vault.Env(name)
+
+		fmt.Println()
+		fmt.Printf("[%s]\n", name)
+		if env.Inherits != "" {
+			fmt.Printf("# inherits %s\n", env.Inherits)
+		}
+		if env.Locked() {
+			sum := sha256.Sum256(env.Sealed)
+			fmt.Printf("# sealed, contents hidden (%s)\n", hex.EncodeToString(sum[:8]))
+			continue
+		}
+
+		keys := slices.Sorted(maps.Keys(env.Secrets))
+		for _, k := range keys {
+			fmt.Printf("%s = %s\n", k, mask(name, k, env.Secrets[k]))
+		}
+	}
+}
+
+func gitOutput(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	c := exec.Command("git", args...)
+	c.Stderr = &stderr
+
+	out, err := c.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return out, nil
+}
+
+// makes sure the pattern's line in .gitattributes carries the given
+// attributes, replacing other values of the same attribute
+func ensureGitAttributes(path, pattern string, attrs ...string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+
+	found := false
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != pattern {
+			continue
+		}
+
+		existing := fields[1:]
+		for _, attr := range attrs {
+			existing = setAttribute(existing, attr)
+		}
+		lines[i] = strings.Join(append([]string{pattern}, existing...), " ")
+		found = true
+	}
+
+	if !found {
+		lines = append(lines, strings.Join(append([]string{pattern}, attrs...), " "))
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+func setAttribute(attrs []string, attr string) []string {
+	name := attributeName(attr)
+
+	out := make([]string, 0, len(attrs)+1)
+	for _, a := range attrs {
+		if attributeName(a) != name {
+			out = append(out, a)
+		}
+	}
+	return append(out, attr)
+}
+
+// "merge=cloak", "-text" and "!diff" -> "merge", "text", "diff"
+func attributeName(attr string) string {
+	name := strings.TrimLeft(attr, "-!")
+	if i := strings.IndexByte(name, '='); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func init() {
+	gitTextconvCmd.Flags().BoolVar(&textconvReveal, "reveal", false, "print real values instead of hashes")
+
+	gitCmd.AddCommand(gitInstallCmd)
+	gitCmd.AddCommand(gitTextconvCmd)
+
+	rootCmd.AddCommand(gitCmd)
+}
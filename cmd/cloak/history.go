@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyKeep   int
+	historyReveal bool
+	rollbackTo    int
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [KEY]",
+	Short: "Show previous values of a secret",
+	Long: `Lists the versions of KEY kept in the selected environment, newest first.
+Values are masked unless --reveal is given. Restore one with 'cloak rollback'.
+
+History is off by default. Turn it on for the whole vault with --keep:
+
+  cloak history --keep 10   # keep the last 10 values of every key
+  cloak history --keep 0    # turn history off and drop what was kept`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MaximumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		if len(args) == 0 && !cmd.Flags().Changed("keep") {
+			return errors.New("missing KEY (or --keep N to configure history)")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		masterKey := RequireKey()
+
+		if cmd.Flags().Changed("keep") {
+			setHistoryDepth(masterKey)
+			if len(args) == 0 {
+				return
+			}
+		}
+
+		key := args[0]
+		vault := loadVault(masterKey)
+		env := requireEnv(vault, currentEnv())
+
+		versions := env.HistoryOf(key)
+		current, exists := env.Secrets[key]
+		if !exists && len(versions) == 0 {
+			color.Red("✖ Error: %s has no value or history in '%s'.", key, currentEnv())
+			os.Exit(1)
+		}
+
+		mask := func(v string) string {
+			if historyReveal {
+				return strconv.Quote(v)
+			}
+			return "••••••••••••"
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tUPDATED\tBY\tVALUE")
+		if exists {
+			m := env.MetaOf(key)
+			fmt.Fprintf(w, "current\t%s\t%s\t%s\n", formatTime(m.Updated), dash(m.ModifiedBy), mask(current))
+		} else {
+			fmt.Fprintf(w, "current\t-\t-\t(deleted)\n")
+		}
+		for i, v := range versions {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i+1, formatTime(v.Updated), dash(v.ModifiedBy), mask(v.Value))
+		}
+		w.Flush()
+
+		if vault.HistoryDepth == 0 {
+			color.New(color.FgHiBlack).Println("History is off. Turn it on with 'cloak history --keep N'.")
+		}
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback KEY --to N",
+	Short: "Restore a previous value of a secret",
+	Long: `Sets KEY back to version N as listed by 'cloak history KEY'. The value being
+replaced is kept in history, so a rollback can itself be rolled back.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := args[0]
+
+		masterKey := RequireKey()
+		defer lockVault()()
+
+		vault := loadVault(masterKey)
+		env := requireEnv(vault, currentEnv())
+
+		if err := env.Rollback(key, rollbackTo, currentAuthor(), time.Now().UTC()); err != nil {
+			color.Red("✖ Error: %v", err)
+			os.Exit(1)
+		}
+
+		if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
+			color.Red("Failed to save store: %v", err)
+			os.Exit(1)
+		}
+
+		color.Cyan("✔ Rolled %s back to version %d", key, rollbackTo)
+	},
+}
+
+func setHistoryDepth(masterKey string) {
+	if historyKeep < 0 {
+		color.Red("✖ Error: --keep cannot be negative.")
+		os.Exit(1)
+	}
+
+	defer lockVault()()
+
+	vault := loadVault(masterKey)
+	vault.HistoryDepth = historyKeep
+
+	// sealed environments are only trimmed when they can be unlocked
+	var untrimmed []string
+	for _, n := range vault.EnvNames() {
+		env, _ := vault.Env(n)
+		if !env.Locked() {
+			continue
+		}
+		if key := envKey(n); key == "" || env.Unlock(key) != nil {
+			untrimmed = append(untrimmed, n)
+		}
+	}
+
+	if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
+		color.Red("Failed to save store: %v", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if len(untrimmed) > 0 {
+			color.Yellow("⚠ The history of sealed environments %s was left as it is.", strings.Join(untrimmed, ", "))
+			color.Yellow("  Trim one by running 'CLOAK_ENV_KEY=... cloak -e ENV history --keep %d'.", historyKeep)
+		}
+	}()
+
+	if historyKeep == 0 {
+		color.Cyan("✔ History turned off.")
+		return
+	}
+	color.Cyan("✔ Keeping the last %d values of every key.", historyKeep)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func init() {
+	historyCmd.Flags().IntVar(&historyKeep, "keep", 0, "number of previous values to keep per key (0 turns history off)")
+	historyCmd.Flags().BoolVar(&historyReveal, "reveal", false, "print values instead of masking them")
+	rollbackCmd.Flags().IntVar(&rollbackTo, "to", 0, "version to restore (see 'cloak history KEY')")
+	rollbackCmd.MarkFlagRequired("to")
+
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(rollbackCmd)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/envfile"
+	"github.com/atomisadev/cloak/pkg/injector"
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/charmbracelet/x/term"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat   string
+	importStrategy string
+	importDelete   bool
+	importRaw      bool
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import FILE",
+	Short: "Import secrets from a .env, JSON, YAML or docker env-file",
+	Long: `Reads FILE and adds its variables to the selected environment. The format is
+taken from the extension (.json, .yaml/.yml, anything else is dotenv); use
+--format docker for 'docker run --env-file' files, which take values literally.
+
+Values are stored literally: a ${NAME} in the file is kept as text rather
+than becoming a reference to another secret. --raw stores them as they are,
+references included (for files written by 'cloak export --raw').
+
+Keys that already exist with a different value are handled by --strategy:
+  fail           abort without changing anything (default)
+  overwrite      replace them with the imported value
+  keep-existing  leave them as they are
+
+Once imported, the plaintext file should go. cloak offers to overwrite and
+delete it (--delete does so without asking). On SSDs and copy-on-write
+filesystems old blocks may survive, so treat the file as exposed anyway.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := args[0]
+
+		format := importFormat
+		if format == "" {
+			format = envfile.DetectFormat(path)
+		}
+		if !slices.Contains([]string{"fail", "overwrite", "keep-existing"}, importStrategy) {
+			color.Red("Error: unknown strategy '%s' (use fail, overwrite or keep-existing).", importStrategy)
+			os.Exit(1)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			color.Red("Failed to read %s: %v", path, err)
+			os.Exit(1)
+		}
+		imported, err := envfile.Parse(format, data)
+		if err != nil {
+			color.Red("Failed to parse %s as %s: %v", path, format, err)
+			os.Exit(1)
+		}
+		if !importRaw {
+			for k, v := range imported {
+				imported[k] = injector.Escape(v)
+			}
+		}
+
+		masterKey := RequireKey()
+		defer lockVault()()
+
+		vault := loadVault(masterKey)
+		envName := currentEnv()
+		env := requireEnv(vault, envName)
+
+		var conflicts []string
+		for _, k := range slices.Sorted(maps.Keys(imported)) {
+			if old, ok := env.Secrets[k]; ok && old != imported[k] {
+				conflicts = append(conflicts, k)
+			}
+		}
+		if len(conflicts) > 0 && importStrategy == "fail" {
+			color.Red("✖ %d key(s) already exist in '%s' with a different value:", len(conflicts), envName)
+			for _, k := range conflicts {
+				fmt.Printf("  %s\n", k)
+			}
+			color.Yellow("Re-run with --strategy overwrite or --strategy keep-existing.")
+			os.Exit(1)
+		}
+
+		author, now := currentAuthor(), time.Now().UTC()
+		added, updated, kept := 0, 0, 0
+		for k, v := range imported {
+			old, exists := env.Secrets[k]
+			switch {
+			case !exists:
+				added++
+			case old == v:
+				continue
+			case importStrategy == "keep-existing":
+				kept++
+				continue
+			default:
+				updated++
+			}
+			env.Set(k, v, author, now)
+		}
+
+		if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
+			color.Red("Failed to save store: %v", err)
+			os.Exit(1)
+		}
+
+		color.Green("✔ Imported %s into '%s': %d added, %d updated, %d kept.", path, envName, added, updated, kept)
+
+		if importDelete || term.IsTerminal(os.Stdin.Fd()) && confirm(fmt.Sprintf("Securely delete %s now?", path)) {
+			if err := shredFile(path); err != nil {
+				color.Red("Failed to delete %s: %v", path, err)
+				os.Exit(1)
+			}
+			color.Green("✔ %s overwritten and deleted.", path)
+		} else {
+			color.Yellow("⚠ %s still holds your secrets in plaintext.", path)
+		}
+	},
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// overwrites the file with random bytes before removing it, so the
+// plaintext isn't trivially recoverable from the freed blocks
+func shredFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	noise := make([]byte, info.Size())
+	rand.Read(noise)
+	if _, err := f.WriteAt(noise, 0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFormat, "format", "", "input format: dotenv, json, yaml or docker (default: from the file extension)")
+	importCmd.Flags().StringVar(&importStrategy, "strategy", "fail", "what to do with existing keys: fail, overwrite or keep-existing")
+	importCmd.Flags().BoolVar(&importDelete, "delete", false, "securely delete FILE after importing without asking")
+	importCmd.Flags().BoolVar(&importRaw, "raw", false, "keep ${KEY} references in values instead of storing them literally")
+
+	rootCmd.AddCommand(importCmd)
+}
@@ -11,23 +11,31 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var initPassphrase bool
+
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "initialize a new encrypted secret store",
 	Run: func(cmd *cobra.Command, args []string) {
+		defer lockVault()()
+
 		if _, err := os.Stat("cloak.encrypted"); err == nil {
 			color.Red("Error: 'cloak.encrypted' already exists. Aborting to prevent overwrite.")
 			os.Exit(1)
 		}
 
+		if initPassphrase {
+			initWithPassphrase()
+			return
+		}
+
 		masterKey, err := crypto.GenerateKey()
 		if err != nil {
 			fmt.Printf("Failed to generate key: %v\n", err)
 			os.Exit(1)
 		}
 
-		emptyStore := make(map[string]string)
-		if err := store.Save("cloak.encrypted", emptyStore, masterKey); err != nil {
+		if err := store.Save("cloak.encrypted", store.NewVault(), masterKey); err != nil {
 			fmt.Printf("Failed to write store: %v\n", err)
 			os.Exit(1)
 		}
@@ -52,6 +60,33 @@ var initCmd = &cobra.Command{
 	},
 }
 
+func initWithPassphrase() {
+	passphrase := promptNewPassphrase()
+
+	kdf, err := crypto.NewKDFParams()
+	if err != nil {
+		fmt.Printf("Failed to generate key: %v\n", err)
+		os.Exit(1)
+	}
+
+	masterKey, err := crypto.DeriveKey(passphrase, kdf)
+	if err != nil {
+		fmt.Printf("Failed to derive key: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := store.SaveWithHeader("cloak.encrypted", store.NewVault(), masterKey, &store.Header{KDF: kdf}); err != nil {
+		fmt.Printf("Failed to write store: %v\n", err)
+		os.Exit(1)
+	}
+
+	color.Green("✔ Store initialized successfully.")
+	color.Cyan("The vault key is derived from your passphrase (Argon2id).")
+	color.New(color.FgHiBlack).Println("(cloak will ask for it whenever no key is available)")
+}
+
 func init() {
+	initCmd.Flags().BoolVar(&initPassphrase, "passphrase", false, "derive the master key from a passphrase instead of generating one")
+
 	rootCmd.AddCommand(initCmd)
 }
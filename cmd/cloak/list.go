@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var listLong bool
+
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the keys in the selected environment",
+	Long: `Prints the key names (never the values) of the selected environment, including
+inherited keys. --long adds when each key was last updated, by whom, its tags
+and description; --json and --format give the same details to scripts:
+
+  cloak list --format '{{.Key}}{{"\t"}}{{.ModifiedBy}}'`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if machineOutput() {
+			color.Output = os.Stderr
+		}
+
+		vault := loadVault(RequireKey())
+		envName := currentEnv()
+		requireEnv(vault, envName)
+
+		meta, err := vault.ResolveMeta(envName)
+		if err != nil {
+			color.Red("Failed to resolve environment: %v", err)
+			os.Exit(1)
+		}
+		keys := slices.Sorted(maps.Keys(meta))
+
+		entries := make([]secretEntry, len(keys))
+		for i, k := range keys {
+			entries[i] = newSecretEntry(k, nil, meta[k])
+		}
+		if printEntries(entries, false) {
+			return
+		}
+
+		if !listLong {
+			for _, k := range keys {
+				fmt.Println(k)
+			}
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tUPDATED\tBY\tTAGS\tDESCRIPTION")
+		for _, k := range keys {
+			m := meta[k]
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k, formatTime(m.Updated), dash(m.ModifiedBy), dash(strings.Join(m.Tags, ",")), m.Description)
+		}
+		w.Flush()
+	},
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	addOutputFlags(listCmd)
+	listCmd.Flags().BoolVarP(&listLong, "long", "l", false, "show metadata for each key")
+
+	rootCmd.AddCommand(listCmd)
+}
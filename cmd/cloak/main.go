@@ -1,8 +1,15 @@
 package main
 
-import "os"
+import (
+	"os"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+)
 
 func main() {
+	// before anything is decrypted. best effort: cloak still works without it
+	crypto.DisableCoreDumps()
+
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
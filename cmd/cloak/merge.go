@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/atomisadev/cloak/internal/ui"
+	"github.com/atomisadev/cloak/pkg/store"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var mergeDriver bool
+
+var fixMergeCmd = &cobra.Command{
+	Use:   "fix-merge",
+	Short: "Resolve a git merge conflict in cloak.encrypted",
+	Long: `Decrypts the base, ours and theirs versions of cloak.encrypted from the git
+index, merges them key by key and re-encrypts the result. Keys changed on both
+sides are resolved interactively.
+
+With --driver BASE OURS THEIRS [PATH] it runs as a git merge driver (see 'cloak git install'):
+clean merges are written to OURS, true conflicts are left for 'cloak fix-merge'. PATH is
+the vault's path in the repository; its directory decides which key is used.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if mergeDriver {
+			return cobra.RangeArgs(3, 4)(cmd, args)
+		}
+		return cobra.NoArgs(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if mergeDriver {
+			path := ""
+			if len(args) == 4 {
+				path = args[3]
+			}
+			runMergeDriver(args[0], args[1], args[2], path)
+			return
+		}
+
+		// "./" makes git resolve the path against the current directory
+		// rather than the top of the repository
+		ours, err := gitOutput("show", ":2:./cloak.encrypted")
+		if err != nil {
+			color.Red("Error: cloak.encrypted has no merge conflict to fix.")
+			os.Exit(1)
+		}
+		theirs, err := gitOutput("show", ":3:./cloak.encrypted")
+		if err != nil {
+			color.Red("Failed to read their version: %v", err)
+			os.Exit(1)
+		}
+		// no base means both sides added the file independently
+		base, _ := gitOutput("show", ":1:./cloak.encrypted")
+
+		masterKey := RequireKey()
+		defer lockVault()()
+
+		fmt.Println("> Smart Merging keys...")
+		merged, conflicts := mergeVaults(base, ours, theirs, masterKey)
+		hdr := mergeHeaders(base, ours, theirs)
+
+		if len(conflicts) > 0 {
+			if !term.IsTerminal(os.Stdin.Fd()) {
+				printConflicts(conflicts)
+				os.Exit(1)
+			}
+
+			p := tea.NewProgram(ui.InitialMergeModel(conflicts), tea.WithAltScreen())
+			finalModel, err := p.Run()
+			if err != nil {
+				fmt.Printf("Alas, there's been an error: %v", err)
+				os.Exit(1)
+			}
+
+			m, ok := finalModel.(ui.MergeModel)
+			if !ok || !m.Done {
+				color.New(color.FgHiBlack).Println("Merge aborted. cloak.encrypted left untouched.")
+				os.Exit(1)
+			}
+			applyResolutions(merged, m)
+		}
+
+		fmt.Println("> Re-encrypting...")
+		saveMerged("cloak.encrypted", hdr, merged, masterKey)
+
+		if _, err := gitOutput("add", "cloak.encrypted"); err != nil {
+			color.Yellow("⚠ Could not stage cloak.encrypted: %v", err)
+		}
+		color.Green("✔ [ FIXED ] %d conflict(s) resolved.", len(conflicts))
+	},
+}
+
+// git merge driver: exit status 0 means merged cleanly, anything else
+// leaves the file conflicted. git runs it from the top of the repository,
+// so move to the vault's directory first for the keychain lookups
+func runMergeDriver(basePath, oursPath, theirsPath, vaultPath string) {
+	if vaultPath != "" {
+		var err error
+		if oursPath, err = filepath.Abs(oursPath); err == nil {
+			basePath, _ = filepath.Abs(basePath)
+			theirsPath, _ = filepath.Abs(theirsPath)
+			err = os.Chdir(filepath.Dir(vaultPath))
+		}
+		if err != nil {
+			color.Red("Failed to enter the vault directory: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	base, err := os.ReadFile(basePath)
+	if err != nil {
+		color.Red("Failed to read base: %v", err)
+		os.Exit(1)
+	}
+	ours, err := os.ReadFile(oursPath)
+	if err != nil {
+		color.Red("Failed to read ours: %v", err)
+		os.Exit(1)
+	}
+	theirs, err := os.ReadFile(theirsPath)
+	if err != nil {
+		color.Red("Failed to read theirs: %v", err)
+		os.Exit(1)
+	}
+
+	masterKey := RequireKey()
+	merged, conflicts := mergeVaults(base, ours, theirs, masterKey)
+	if len(conflicts) > 0 {
+		printConflicts(conflicts)
+		os.Exit(1)
+	}
+
+	saveMerged(oursPath, mergeHeaders(base, ours, theirs), merged, masterKey)
+	color.Green("✔ cloak.encrypted merged automatically.")
+}
+
+func mergeVaults(base, ours, theirs []byte, masterKey string) (*store.Vault, []store.Conflict) {
+	decode := func(label string, data []byte) *store.Vault {
+		if len(data) == 0 {
+			return &store.Vault{Environments: make(map[string]*store.Environment)}
+		}
+
+		vault, err := store.Decode(data, masterKey)
+		if err != nil {
+			color.Red("Failed to decrypt %s version: %v", label, err)
+			os.Exit(1)
+		}
+		unlockAvailableEnvs(vault)
+		return vault
+	}
+
+	merged, conflicts, err := store.Merge(decode("base", base), decode("our", ours), decode("their", theirs))
+	if err != nil {
+		color.Red("Merge failed: %v", err)
+		os.Exit(1)
+	}
+	return merged, conflicts
+}
+
+// sealed environments can only be merged key by key when we have their key
+func unlockAvailableEnvs(vault *store.Vault) {
+	for _, name := range vault.EnvNames() {
+		env, _ := vault.Env(name)
+		if !env.Locked() {
+			continue
+		}
+		if key := envKey(name); key != "" {
+			_ = env.Unlock(key)
+		}
+	}
+}
+
+func applyResolutions(merged *store.Vault, m ui.MergeModel) {
+	author, now := currentAuthor(), time.Now().UTC()
+	for i, c := range m.Conflicts {
+		env, ok := merged.Env(c.Env)
+		if !ok {
+			continue
+		}
+
+		value := m.Resolved(i)
+		switch {
+		case c.Key == "":
+			env.Inherits = ""
+			if value != nil {
+				env.Inherits = *value
+			}
+		case value == nil:
+			env.Unset(c.Key)
+		default:
+			env.Set(c.Key, *value, author, now)
+		}
+	}
+}
+
+// combines the recipients and grace keys of both sides
+func mergeHeaders(base, ours, theirs []byte) *store.Header {
+	parse := func(label string, data []byte) *store.Header {
+		if len(data) == 0 {
+			return &store.Header{}
+		}
+
+		hdr, err := store.ParseHeader(data)
+		if errors.Is(err, store.ErrLegacyFormat) {
+			return &store.Header{}
+		} else if err != nil {
+			color.Red("Failed to read %s header: %v", label, err)
+			os.Exit(1)
+		}
+		return hdr
+	}
+
+	hdr, err := store.MergeHeaders(parse("base", base), parse("our", ours), parse("their", theirs))
+	if err != nil {
+		color.Red("Merge failed: %v", err)
+		os.Exit(1)
+	}
+	return hdr
+}
+
+func saveMerged(path string, hdr *store.Header, merged *store.Vault, masterKey string) {
+	if err := store.SaveWithHeader(path, merged, masterKey, hdr); err != nil {
+		color.Red("Failed to save store: %v", err)
+		os.Exit(1)
+	}
+}
+
+func printConflicts(conflicts []store.Conflict) {
+	color.Red("✖ %d conflict(s) in cloak.encrypted:", len(conflicts))
+	for _, c := range conflicts {
+		key := c.Key
+		if key == "" {
+			key = "(inherits)"
+		}
+		fmt.Printf("  %s/%s\n", c.Env, key)
+	}
+	color.Yellow("Run 'cloak fix-merge' in a terminal to resolve them.")
+}
+
+func init() {
+	fixMergeCmd.Flags().BoolVar(&mergeDriver, "driver", false, "run as a git merge driver (BASE OURS THEIRS)")
+
+	rootCmd.AddCommand(fixMergeCmd)
+}
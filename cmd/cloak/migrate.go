@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the vault to the current file format",
+	Long:  `Rewrites a legacy headerless (or older versioned) cloak.encrypted in the current format.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		version, err := store.FileVersion("cloak.encrypted")
+		if err != nil {
+			color.Red("Failed to read store: %v", err)
+			os.Exit(1)
+		}
+
+		if version >= store.FormatVersion {
+			color.New(color.FgHiBlack).Printf("Vault already uses format v%d. Nothing to do.\n", store.FormatVersion)
+			return
+		}
+
+		masterKey := RequireKey()
+		defer lockVault()()
+		vault := loadVault(masterKey)
+
+		if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
+			color.Red("Failed to save store: %v", err)
+			os.Exit(1)
+		}
+
+		color.Green("✔ Vault migrated to format v%d.", store.FormatVersion)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+}
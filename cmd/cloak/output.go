@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// exit status for a key that doesn't exist, so scripts can tell it apart
+// from other failures (1)
+const exitKeyNotFound = 2
+
+var (
+	outputJSON   bool
+	outputFormat string
+)
+
+// one secret as printed by --json and seen by --format templates
+type secretEntry struct {
+	Key         string    `json:"key"`
+	Value       *string   `json:"value,omitempty"`
+	Updated     time.Time `json:"updated,omitzero"`
+	ModifiedBy  string    `json:"by,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+}
+
+func newSecretEntry(key string, value *string, m store.SecretMeta) secretEntry {
+	return secretEntry{
+		Key:         key,
+		Value:       value,
+		Updated:     m.Updated,
+		ModifiedBy:  m.ModifiedBy,
+		Description: m.Description,
+		Tags:        m.Tags,
+	}
+}
+
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&outputJSON, "json", false, "print JSON")
+	cmd.Flags().StringVar(&outputFormat, "format", "", "print each entry with a Go template, e.g. '{{.Key}} {{.ModifiedBy}}'")
+	cmd.MarkFlagsMutuallyExclusive("json", "format")
+}
+
+// true when stdout is meant for another program; messages then go to stderr
+func machineOutput() bool {
+	return outputJSON || outputFormat != ""
+}
+
+// prints entries as JSON (an object when single is set, an array otherwise)
+// or through the --format template. reports false when neither flag is set
+func printEntries(entries []secretEntry, single bool) bool {
+	switch {
+	case outputJSON:
+		var v any = entries
+		if single {
+			v = entries[0]
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(v); err != nil {
+			color.Red("Failed to encode JSON: %v", err)
+			os.Exit(1)
+		}
+		return true
+
+	case outputFormat != "":
+		tmpl, err := template.New("format").Option("missingkey=error").Parse(outputFormat)
+		if err != nil {
+			color.Red("Invalid --format template: %v", err)
+			os.Exit(1)
+		}
+		for _, e := range entries {
+			if err := tmpl.Execute(os.Stdout, e); err != nil {
+				color.Red("Failed to render --format template: %v", err)
+				os.Exit(1)
+			}
+			fmt.Println()
+		}
+		return true
+	}
+	return false
+}
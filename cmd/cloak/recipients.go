@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+	"github.com/atomisadev/cloak/pkg/keychain"
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var recipientName string
+
+var recipientsCmd = &cobra.Command{
+	Use:   "recipients",
+	Short: "Manage who can decrypt the vault with their own identity",
+	Long: `Each recipient gets the vault key wrapped for their X25519 public key,
+so access can be granted and revoked per person. The shared master key keeps working.
+
+Recipients print their public key with 'cloak identity'.`,
+}
+
+var recipientsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the recipients of the vault",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		hdr := requireHeader()
+
+		if len(hdr.Recipients) == 0 {
+			color.New(color.FgHiBlack).Println("No recipients. The vault is only readable with the shared master key.")
+			return
+		}
+
+		me := ""
+		if identity, err := keychain.GetIdentity(); err == nil {
+			me, _ = crypto.RecipientOf(identity)
+		}
+
+		for _, r := range hdr.Recipients {
+			name := r.Name
+			if name == "" {
+				name = "-"
+			}
+
+			line := fmt.Sprintf("  %-16s %s", name, r.PublicKey)
+			if r.PublicKey == me {
+				color.Cyan("%s (you)", line)
+				continue
+			}
+			fmt.Println(line)
+		}
+	},
+}
+
+var recipientsAddCmd = &cobra.Command{
+	Use:   "add [PUBLIC_KEY]",
+	Short: "Grant a public key access to the vault",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		publicKey := args[0]
+
+		masterKey := RequireKey()
+		defer lockVault()()
+		hdr := requireHeader()
+
+		vault := loadVault(masterKey)
+
+		if err := hdr.AddRecipient(recipientName, publicKey, masterKey); err != nil {
+			color.Red("Failed to add recipient: %v", err)
+			os.Exit(1)
+		}
+
+		if err := store.SaveWithHeader("cloak.encrypted", vault, masterKey, hdr); err != nil {
+			color.Red("Failed to save store: %v", err)
+			os.Exit(1)
+		}
+
+		color.Green("✔ Added recipient %s", publicKey)
+	},
+}
+
+var recipientsRemoveCmd = &cobra.Command{
+	Use:   "remove [PUBLIC_KEY|NAME]",
+	Short: "Revoke a recipient and rotate the vault key",
+	Long: `Removes the recipient and re-encrypts the vault under a fresh key,
+so anything they may have cached stops working. Remaining recipients are re-wrapped automatically.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		masterKey := RequireKey()
+		defer lockVault()()
+		hdr := requireHeader()
+
+		vault := loadVault(masterKey)
+
+		removed := hdr.RemoveRecipient(args[0])
+		if len(removed) == 0 {
+			color.Red("Error: no recipient matches '%s'.", args[0])
+			os.Exit(1)
+		}
+
+		newKey := rekeyVault(vault, hdr, "", 0)
+
+		color.Green("✔ Removed %d recipient(s) and rotated the vault key.", len(removed))
+		printRotatedKey(hdr, newKey)
+	},
+}
+
+var identityCmd = &cobra.Command{
+	Use:   "identity",
+	Short: "Print your public key (creating an identity on first use)",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		identity, err := keychain.GetIdentity()
+		if err != nil || identity == "" {
+			identity, _, err = crypto.GenerateIdentity()
+			if err != nil {
+				color.Red("Failed to generate identity: %v", err)
+				os.Exit(1)
+			}
+			if err := keychain.SaveIdentity(identity); err != nil {
+				color.Red("Failed to save identity: %v", err)
+				os.Exit(1)
+			}
+			color.Cyan("New identity saved to System Keychain.")
+		}
+
+		publicKey, err := crypto.RecipientOf(identity)
+		if err != nil {
+			color.Red("Stored identity is invalid: %v", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Your public key (share it with a vault owner):")
+		fmt.Println()
+		color.New(color.FgGreen, color.Bold).Printf("   %s\n", publicKey)
+		fmt.Println()
+		color.New(color.FgHiBlack).Println("They can grant access with: cloak recipients add <key> --name <you>")
+	},
+}
+
+func requireHeader() *store.Header {
+	hdr, err := store.ReadHeader("cloak.encrypted")
+	if errors.Is(err, store.ErrLegacyFormat) {
+		color.Red("Error: the vault uses the legacy format. Run 'cloak migrate' first.")
+		os.Exit(1)
+	}
+	if err != nil {
+		color.Red("Failed to read store: %v", err)
+		os.Exit(1)
+	}
+	return hdr
+}
+
+func init() {
+	recipientsAddCmd.Flags().StringVar(&recipientName, "name", "", "label for the recipient")
+
+	recipientsCmd.AddCommand(recipientsListCmd)
+	recipientsCmd.AddCommand(recipientsAddCmd)
+	recipientsCmd.AddCommand(recipientsRemoveCmd)
+
+	rootCmd.AddCommand(recipientsCmd)
+	rootCmd.AddCommand(identityCmd)
+}
@@ -48,5 +48,7 @@ func printWelcome() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVarP(&envFlag, "env", "e", "", "environment to use (default $CLOAK_ENV or 'default')")
+
 	rootCmd.AddCommand(versionCmd)
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+	"github.com/atomisadev/cloak/pkg/keychain"
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var rotateGrace time.Duration
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the master key and re-encrypt the vault",
+	Long: `Generates a new master key, re-encrypts the vault with it and updates the
+keychain entry for this project. The new key is printed once. Environments
+sealed with their own key are left as they are.
+
+Use --grace to keep the old key working for a while (e.g. --grace 72h) so CI
+can be updated without downtime. Rotating again ends any previous grace period.
+
+--grace works by storing the new key in cloak.encrypted, encrypted under the
+old one, so whoever has the old key and the file (or its git history) can
+recover the new key, even after the grace period. Never use it to rotate away
+from a leaked key, and once everything uses the new key, rotate again without
+--grace: that key has never been wrapped under anything.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		oldKey := RequireKey()
+		defer lockVault()()
+
+		hdr, err := store.ReadHeader("cloak.encrypted")
+		if errors.Is(err, store.ErrLegacyFormat) {
+			hdr = &store.Header{}
+		} else if err != nil {
+			color.Red("Failed to read store: %v", err)
+			os.Exit(1)
+		}
+
+		vault := loadVault(oldKey)
+
+		newKey := rekeyVault(vault, hdr, oldKey, rotateGrace)
+
+		color.Green("✔ Master key rotated. %d environment(s) re-encrypted.", len(vault.Environments))
+		if rotateGrace > 0 {
+			color.Yellow("⚠ The old key keeps working until %s.", hdr.Grace[0].Expires.Local().Format(time.RFC1123))
+			color.New(color.FgRed, color.Bold).Println("⚠ The new key is stored in the vault wrapped under the old key, and stays in git history.")
+			color.Red("  Anyone with the old key can recover it. If the old key leaked, rotate again now without --grace.")
+			color.Red("  Otherwise run 'cloak rotate' again without --grace once the grace period is over.")
+		}
+		printRotatedKey(hdr, newKey)
+	},
+}
+
+// re-encrypts the vault under a fresh key (or a fresh passphrase for
+// passphrase vaults), re-wrapping it for every recipient left in hdr.
+// with a grace period, oldKey keeps unlocking the vault until it expires
+func rekeyVault(vault *store.Vault, hdr *store.Header, oldKey string, grace time.Duration) string {
+	newHdr := &store.Header{}
+
+	var newKey string
+	var err error
+	if hdr.KDF != nil {
+		passphrase := promptNewPassphrase()
+		if newHdr.KDF, err = crypto.NewKDFParams(); err == nil {
+			newKey, err = crypto.DeriveKey(passphrase, newHdr.KDF)
+		}
+	} else {
+		newKey, err = crypto.GenerateKey()
+	}
+	if err != nil {
+		color.Red("Failed to generate key: %v", err)
+		os.Exit(1)
+	}
+
+	for _, r := range hdr.Recipients {
+		if err := newHdr.AddRecipient(r.Name, r.PublicKey, newKey); err != nil {
+			color.Red("Failed to re-wrap key for %s: %v", r.PublicKey, err)
+			os.Exit(1)
+		}
+	}
+
+	if grace > 0 {
+		if err := newHdr.AddGraceKey(oldKey, newKey, time.Now().Add(grace)); err != nil {
+			color.Red("Failed to set up grace period: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := store.SaveWithHeader("cloak.encrypted", vault, newKey, newHdr); err != nil {
+		color.Red("Failed to save store: %v", err)
+		os.Exit(1)
+	}
+
+	*hdr = *newHdr
+	return newKey
+}
+
+// prints the new key once and updates the keychain after a re-key
+func printRotatedKey(hdr *store.Header, newKey string) {
+	if hdr.KDF != nil {
+		color.Cyan("The vault is now protected by the new passphrase.")
+		return
+	}
+
+	fmt.Println("Here is the new MASTER KEY. It will not be shown again:")
+	fmt.Println()
+	color.New(color.FgGreen, color.Bold).Println(newKey)
+	fmt.Println()
+
+	wd, _ := os.Getwd()
+	if err := keychain.Save(wd, newKey); err != nil {
+		color.Yellow("⚠ Could not save to Keychain: %v", err)
+	} else {
+		color.Cyan("Keychain entry for this project updated.")
+	}
+	color.New(color.FgHiBlack).Println("Recipients keep access automatically. Anyone using the shared key needs the new one.")
+}
+
+func init() {
+	rotateCmd.Flags().DurationVar(&rotateGrace, "grace", 0, "keep the old key valid for this long (e.g. 72h)")
+
+	rootCmd.AddCommand(rotateCmd)
+}
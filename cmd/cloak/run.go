@@ -5,33 +5,70 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/atomisadev/cloak/pkg/injector"
-	"github.com/atomisadev/cloak/pkg/store"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
+var (
+	runOpts  injector.Options
+	runFiles []string
+)
+
 var runCmd = &cobra.Command{
 	Use:   "run -- [COMMAND]",
 	Short: "Run a command with secrets injected",
-	Long:  `Decrypts the secret store and injects environment variables into the specified command`,
-	Args:  cobra.MinimumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		masterKey := RequireKey()
+	Long: `Decrypts the secret store and injects environment variables into the specified command.
 
-		secrets, err := store.Load("cloak.encrypted", masterKey)
-		if err != nil {
-			color.Red("Failed to load store: %v", err)
-			os.Exit(1)
+Tools that want a credentials file instead of a variable can get one without
+it ever touching the disk (Linux only):
+
+  cloak run --file GOOGLE_APPLICATION_CREDENTIALS=SA_JSON -- ./server
+
+The secret is put in a sealed in-memory file and the variable is set to its
+/proc/self/fd path. The memory is released as soon as the command exits.
+
+--redact replaces every injected value in the command's output with ***KEY***,
+including base64 and URL-encoded forms, so a stray debug print doesn't end up
+in CI logs. Values shorter than 4 characters are left alone.
+
+Choosing what the command sees:
+  --only A,B / --exclude C     inject only some keys, or all but some
+  --strip-prefix / --prefix    rename: APP_DB_URL -> DB_URL -> NEXT_DB_URL
+  --clean-env                  don't pass the shell's environment, except
+                               PATH, HOME, USER, LOGNAME, SHELL, TERM, LANG,
+                               LC_*, TZ, TMPDIR and --keep-env NAME,PATTERN*
+
+Each variable is set exactly once. When a secret has the same name as a
+variable that is already set, the secret wins; with --no-override the
+existing variable is kept instead.
+
+The command runs in a process group of its own. Signals cloak receives
+(INT, TERM, HUP, QUIT, USR1, USR2, WINCH) are passed on to the whole group,
+so tools that spawn helpers shut down completely. If the group is still
+around --grace-period after being asked to stop, it is killed. cloak exits
+with the command's status, or 128+N when it was killed by signal N.
+
+For development, --watch restarts the command whenever cloak.encrypted
+changes (after 'cloak set', a git pull, ...), with the new values. Add
+--watch-path 'src/**/*.go' to restart on source changes too. The old process
+is stopped like on Ctrl-C, with --grace-period to exit. --restart-on-exit
+restarts a command that exits by itself, waiting 1s, 2s, 4s, ... (at most
+30s) between attempts while it keeps crashing. Ctrl-C ends either mode.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if runWatch || len(runWatchPaths) > 0 || runRestartOnExit {
+			os.Exit(runSupervised(args))
 		}
 
-		cyan := color.New(color.FgCyan, color.Bold)
-		cyan.Printf("[CLOAK] Injecting %d secrets into %s\n", len(secrets), strings.Join(args, " "))
+		secrets := prepareInjection(args)
 
-		if err := injector.RunCommand(args, secrets); err != nil {
+		if err := injector.RunCommand(args, secrets, runOpts); err != nil {
 			if exitErr, ok := err.(*exec.ExitError); ok {
-				os.Exit(exitErr.ExitCode())
+				os.Exit(exitCode(exitErr))
 			}
 
 			if strings.Contains(args[0], " ") && strings.Contains(err.Error(), "executable file not found") {
@@ -46,8 +83,83 @@ var runCmd = &cobra.Command{
 	},
 }
 
+// the status a shell would report: 128+N for a command killed by signal N
+func exitCode(err *exec.ExitError) int {
+	if ws, ok := err.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return err.ExitCode()
+}
+
+// decrypts the selected environment and announces what is injected into
+// command. shared by run and exec
+func prepareInjection(command []string) map[string]string {
+	return injectionSecrets(RequireKey(), command)
+}
+
+func injectionSecrets(masterKey string, command []string) map[string]string {
+	runOpts.Files = make(map[string]string, len(runFiles))
+	for _, f := range runFiles {
+		name, key, ok := strings.Cut(f, "=")
+		if !ok || name == "" || key == "" {
+			color.Red("Error: invalid --file '%s' (expected VAR=KEY).", f)
+			os.Exit(1)
+		}
+		runOpts.Files[name] = key
+	}
+
+	vault := loadVault(masterKey)
+	envName := currentEnv()
+	requireEnv(vault, envName)
+
+	secrets, err := vault.Resolve(envName)
+	if err != nil {
+		color.Red("Failed to resolve environment: %v", err)
+		os.Exit(1)
+	}
+
+	injected, err := injector.SelectSecrets(secrets, runOpts)
+	if err != nil {
+		color.Red("Error: %v", err)
+		os.Exit(1)
+	}
+
+	cyan := color.New(color.FgCyan, color.Bold)
+	cyan.Printf("[CLOAK] Injecting %d secrets (%s) into %s\n", len(injected), envName, strings.Join(command, " "))
+	if runOpts.Redact {
+		warnUnredactable(secrets)
+	}
+
+	return secrets
+}
+
+func warnUnredactable(secrets map[string]string) {
+	if keys := injector.Unredactable(secrets); len(keys) > 0 {
+		color.Yellow("⚠ Not redacting %s: values this short would be masked everywhere in the output.", strings.Join(keys, ", "))
+	}
+}
+
+// the flags run and exec have in common
+func addInjectionFlags(cmd *cobra.Command) {
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().StringArrayVar(&runFiles, "file", nil, "expose secret KEY as an in-memory file whose path is put in VAR (VAR=KEY, repeatable)")
+	cmd.Flags().StringSliceVar(&runOpts.Only, "only", nil, "inject only these keys")
+	cmd.Flags().StringSliceVar(&runOpts.Exclude, "exclude", nil, "don't inject these keys")
+	cmd.Flags().StringVar(&runOpts.Prefix, "prefix", "", "add this prefix to every injected variable")
+	cmd.Flags().StringVar(&runOpts.StripPrefix, "strip-prefix", "", "remove this prefix from injected variables that have it")
+	cmd.Flags().BoolVar(&runOpts.CleanEnv, "clean-env", false, "don't pass on the current environment (see --keep-env)")
+	cmd.Flags().StringSliceVar(&runOpts.KeepEnv, "keep-env", nil, "with --clean-env, also keep these variables (patterns like AWS_* allowed)")
+	cmd.Flags().BoolVar(&runOpts.NoOverride, "no-override", false, "keep variables that are already set instead of replacing them with secrets")
+}
+
 func init() {
-	runCmd.Flags().SetInterspersed(false)
+	addInjectionFlags(runCmd)
+	runCmd.Flags().BoolVar(&runOpts.Redact, "redact", false, "mask secret values in the command's stdout and stderr")
+	runCmd.Flags().BoolVarP(&runWatch, "watch", "w", false, "restart the command when cloak.encrypted changes")
+	runCmd.Flags().StringArrayVar(&runWatchPaths, "watch-path", nil, "also restart when files matching this glob change (** allowed, repeatable)")
+	runCmd.Flags().DurationVar(&runDebounce, "debounce", 500*time.Millisecond, "wait for changes to settle this long before restarting")
+	runCmd.Flags().BoolVar(&runRestartOnExit, "restart-on-exit", false, "restart the command when it exits, with backoff")
+	runCmd.Flags().DurationVar(&runOpts.GracePeriod, "grace-period", injector.DefaultGracePeriod, "time the command gets to exit after INT/TERM before it is killed")
 
 	rootCmd.AddCommand(runCmd)
 }
@@ -1,32 +1,66 @@
 package main
 
 import (
+	"errors"
 	"os"
+	"time"
 
 	"github.com/atomisadev/cloak/pkg/store"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
+var (
+	setDescription string
+	setTags        []string
+)
+
 var setCmd = &cobra.Command{
 	Use:   "set [KEY] [VALUE]",
 	Short: "Add or update a secret",
-	Args:  cobra.ExactArgs(2),
+	Long: `Adds or updates a secret. Use --desc and --tag to document it; both can also be
+changed on their own by leaving out VALUE:
+
+  cloak set STRIPE_KEY sk_live_... --desc "billing, owned by payments" --tag prod --tag billing
+  cloak set STRIPE_KEY --desc "billing, rotate quarterly"`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.RangeArgs(1, 2)(cmd, args); err != nil {
+			return err
+		}
+		if len(args) == 1 && !cmd.Flags().Changed("desc") && !cmd.Flags().Changed("tag") {
+			return errors.New("missing VALUE (or --desc/--tag to only update the metadata)")
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		key := args[0]
-		value := args[1]
 
 		masterKey := RequireKey()
+		defer lockVault()()
 
-		secrets, err := store.Load("cloak.encrypted", masterKey)
-		if err != nil {
-			color.Red("Failed to load store: %v", err)
+		vault := loadVault(masterKey)
+		env := requireEnv(vault, currentEnv())
+
+		if len(args) == 2 {
+			env.Set(key, args[1], currentAuthor(), time.Now().UTC())
+		} else if _, ok := env.Secrets[key]; !ok {
+			color.Red("✖ Error: %s is not set in '%s'.", key, currentEnv())
 			os.Exit(1)
 		}
 
-		secrets[key] = value
+		var description *string
+		if cmd.Flags().Changed("desc") {
+			description = &setDescription
+		}
+		var tags []string
+		if cmd.Flags().Changed("tag") {
+			tags = setTags
+		}
+		if description != nil || tags != nil {
+			env.Describe(key, description, tags)
+		}
 
-		if err := store.Save("cloak.encrypted", secrets, masterKey); err != nil {
+		if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
 			color.Red("Failed to save store: %v", err)
 			os.Exit(1)
 		}
@@ -36,5 +70,8 @@ var setCmd = &cobra.Command{
 }
 
 func init() {
+	setCmd.Flags().StringVar(&setDescription, "desc", "", "free-text description of the secret")
+	setCmd.Flags().StringArrayVar(&setTags, "tag", nil, "tag the secret (repeatable, replaces existing tags)")
+
 	rootCmd.AddCommand(setCmd)
 }
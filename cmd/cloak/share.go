@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+	"github.com/atomisadev/cloak/pkg/keychain"
+	"github.com/atomisadev/cloak/pkg/sharing"
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	shareBackend  string
+	shareTTL      time.Duration
+	shareEndpoint string
+)
+
+var shareCmd = &cobra.Command{
+	Use:   "share",
+	Short: "Share the Master Key as a one-time link",
+	Long: `Encrypts the Master Key with a one-off key, uploads the ciphertext to a
+dead drop and prints a link. The decryption key lives in the link's #fragment,
+so the drop only ever sees ciphertext. The receiver runs 'cloak claim <link>'.
+
+Backends:
+  fileio  file.io (default), deleted after the first download. Use --endpoint
+          (or CLOAK_SHARE_ENDPOINT) to point it at your own 'cloak drop-server'
+  s3      any S3-compatible bucket, configured through
+          CLOAK_S3_ENDPOINT, CLOAK_S3_BUCKET, CLOAK_S3_REGION, CLOAK_S3_PREFIX,
+          AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+          The link stays valid until --ttl; add a lifecycle rule to the bucket
+          to clean up old drops.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if shareTTL <= 0 {
+			color.Red("Error: --ttl must be greater than zero.")
+			os.Exit(1)
+		}
+
+		backend, err := dropBackend(shareBackend)
+		if err != nil {
+			color.Red("Error: %v", err)
+			os.Exit(1)
+		}
+
+		masterKey := RequireKey()
+
+		link, err := sharing.CreateDeadDrop(context.Background(), backend, []byte(masterKey), shareTTL)
+		if err != nil {
+			color.Red("Failed to create dead drop: %v", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Dead drop created. Send this link to the receiver:")
+		fmt.Println()
+		color.New(color.FgGreen, color.Bold).Printf("   %s\n", link)
+		fmt.Println()
+		color.New(color.FgHiBlack).Printf("They run: cloak claim '<link>' (expires in %s)\n", shareTTL)
+	},
+}
+
+var claimCmd = &cobra.Command{
+	Use:   "claim <LINK>",
+	Short: "Claim a Master Key shared with 'cloak share'",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := sharing.ClaimDeadDrop(context.Background(), args[0])
+		if err != nil {
+			color.Red("Failed to claim dead drop: %v", err)
+			os.Exit(1)
+		}
+
+		masterKey := string(data)
+		raw, err := hex.DecodeString(masterKey)
+		if err != nil || len(raw) != 32 {
+			color.Red("✖ Error: the dead drop doesn't hold a cloak master key. Nothing was saved.")
+			os.Exit(1)
+		}
+		if err := checkClaimedKey(masterKey, raw); err != nil {
+			// the drop is gone now, so don't lose the key
+			color.Red("✖ Error: %v. Nothing was saved.", err)
+			fmt.Println("Here is the key, to save from the right project:")
+			fmt.Println(masterKey)
+			os.Exit(1)
+		}
+		wd, _ := os.Getwd()
+
+		if err := keychain.Save(wd, masterKey); err != nil {
+			color.Yellow("⚠ Claimed key, but could not save to Keychain: %v", err)
+			fmt.Println("Here is the key (copy manually):")
+			fmt.Println(masterKey)
+			return
+		}
+
+		color.Green("✔ Master Key claimed and saved to Keychain.")
+		color.New(color.FgHiBlack).Printf("  Scope: %s\n", wd)
+		fmt.Println("You can now run 'cloak run' or 'cloak edit'.")
+	},
+}
+
+// makes sure a key claimed next to a vault is the one that opens it, so the
+// keychain entry for this directory isn't replaced by an unrelated key
+func checkClaimedKey(masterKey string, raw []byte) error {
+	if _, err := os.Stat("cloak.encrypted"); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	hdr, err := store.ReadHeader("cloak.encrypted")
+	switch {
+	case errors.Is(err, store.ErrLegacyFormat):
+		if _, err := store.Load("cloak.encrypted", masterKey); err != nil {
+			return errors.New("the claimed key doesn't open cloak.encrypted here")
+		}
+	case err != nil:
+		return err
+	case hdr.KeyID != crypto.KeyID(raw):
+		return fmt.Errorf("the claimed key (id %s) doesn't open cloak.encrypted here (key id %s)", crypto.KeyID(raw), hdr.KeyID)
+	}
+	return nil
+}
+
+func dropBackend(name string) (sharing.DropBackend, error) {
+	switch name {
+	case "fileio":
+		endpoint := shareEndpoint
+		if endpoint == "" {
+			endpoint = os.Getenv("CLOAK_SHARE_ENDPOINT")
+		}
+		return &sharing.FileIO{Endpoint: endpoint}, nil
+	case "s3":
+		return &sharing.S3{
+			Endpoint:     os.Getenv("CLOAK_S3_ENDPOINT"),
+			Region:       os.Getenv("CLOAK_S3_REGION"),
+			Bucket:       os.Getenv("CLOAK_S3_BUCKET"),
+			Prefix:       os.Getenv("CLOAK_S3_PREFIX"),
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown backend '%s' (use fileio or s3)", name)
+}
+
+func init() {
+	shareCmd.Flags().StringVar(&shareBackend, "backend", "fileio", "where to park the encrypted key: fileio or s3")
+	shareCmd.Flags().StringVar(&shareEndpoint, "endpoint", "", "file.io compatible server to use (default "+sharing.FileIOEndpoint+")")
+	shareCmd.Flags().DurationVar(&shareTTL, "ttl", 24*time.Hour, "how long the link stays valid")
+
+	rootCmd.AddCommand(shareCmd)
+	rootCmd.AddCommand(claimCmd)
+}
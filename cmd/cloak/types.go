@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/atomisadev/cloak/pkg/typegen"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	typesLang    string
+	typesOut     string
+	typesPackage string
+	typesCheck   bool
+)
+
+var typesCmd = &cobra.Command{
+	Use:     "types",
+	Aliases: []string{"eject"},
+	Short:   "Generate type definitions for your secrets",
+	Long: `Reads the key names (never the values) of the selected environment and writes
+type definitions for your IDE:
+
+  ts      env.d.ts   (NodeJS.ProcessEnv)
+  python  config.py  (Pydantic settings class)
+  go      env.go     (struct with env tags and a Load function)
+  rust    env.rs     (struct with a from_env constructor)
+
+Use --check in CI to fail when the generated file is out of date.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		defaultFile, ok := typegen.DefaultFiles[typesLang]
+		if !ok {
+			color.Red("Error: unsupported language '%s' (use ts, python, go or rust).", typesLang)
+			os.Exit(1)
+		}
+		out := typesOut
+		if out == "" {
+			out = defaultFile
+		}
+
+		vault := loadVault(RequireKey())
+		envName := currentEnv()
+		requireEnv(vault, envName)
+
+		secrets, err := vault.Resolve(envName)
+		if err != nil {
+			color.Red("Failed to resolve environment: %v", err)
+			os.Exit(1)
+		}
+
+		generated, err := typegen.Generate(typesLang, slices.Collect(maps.Keys(secrets)), typegen.Options{Package: typesPackage})
+		if err != nil {
+			color.Red("Failed to generate types: %v", err)
+			os.Exit(1)
+		}
+
+		if typesCheck {
+			existing, err := os.ReadFile(out)
+			if err != nil || !bytes.Equal(existing, generated) {
+				color.Red("✖ %s is out of date with the vault.", out)
+				color.Yellow("  Run 'cloak types --lang=%s' and commit the result.", typesLang)
+				os.Exit(1)
+			}
+			color.Green("✔ %s is up to date.", out)
+			return
+		}
+
+		if err := os.WriteFile(out, generated, 0644); err != nil {
+			color.Red("Failed to write %s: %v", out, err)
+			os.Exit(1)
+		}
+
+		color.Green("✔ Generated %s (%d keys)", out, len(secrets))
+	},
+}
+
+func init() {
+	typesCmd.Flags().StringVar(&typesLang, "lang", "ts", "target language: ts, python, go or rust")
+	typesCmd.Flags().StringVarP(&typesOut, "out", "o", "", "output file (default depends on --lang)")
+	typesCmd.Flags().StringVar(&typesPackage, "package", "env", "package name for Go output")
+	typesCmd.Flags().BoolVar(&typesCheck, "check", false, "fail if the output file is stale instead of writing it")
+
+	rootCmd.AddCommand(typesCmd)
+}
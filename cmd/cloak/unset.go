@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var unsetIgnoreMissing bool
+
+var unsetCmd = &cobra.Command{
+	Use:     "unset KEY...",
+	Aliases: []string{"rm"},
+	Short:   "Remove secrets",
+	Long: `Removes one or more keys from the selected environment. Nothing is removed if
+any of them doesn't exist there (exit status 2), unless --ignore-missing is given.
+Keys inherited from another environment have to be removed from that environment.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if machineOutput() {
+			color.Output = os.Stderr
+		}
+
+		masterKey := RequireKey()
+		defer lockVault()()
+
+		vault := loadVault(masterKey)
+		envName := currentEnv()
+		env := requireEnv(vault, envName)
+
+		removed := make([]secretEntry, 0, len(args))
+		for _, key := range args {
+			if _, ok := env.Secrets[key]; ok {
+				removed = append(removed, newSecretEntry(key, nil, env.MetaOf(key)))
+				continue
+			}
+			if unsetIgnoreMissing {
+				continue
+			}
+
+			color.Red("✖ Error: %s is not set in '%s'.", key, envName)
+			if secrets, err := vault.Resolve(envName); err == nil {
+				if _, inherited := secrets[key]; inherited {
+					color.Yellow("  It is inherited; remove it from the environment that defines it.")
+				}
+			}
+			os.Exit(exitKeyNotFound)
+		}
+
+		if len(removed) == 0 {
+			if !printEntries(removed, false) {
+				color.New(color.FgHiBlack).Println("Nothing to remove.")
+			}
+			return
+		}
+
+		for _, e := range removed {
+			env.Unset(e.Key)
+		}
+
+		if err := store.Save("cloak.encrypted", vault, masterKey); err != nil {
+			color.Red("Failed to save store: %v", err)
+			os.Exit(1)
+		}
+
+		if printEntries(removed, false) {
+			return
+		}
+		for _, e := range removed {
+			color.Cyan("✔ Removed %s", e.Key)
+		}
+	},
+}
+
+func init() {
+	addOutputFlags(unsetCmd)
+	unsetCmd.Flags().BoolVar(&unsetIgnoreMissing, "ignore-missing", false, "skip keys that don't exist instead of failing")
+
+	rootCmd.AddCommand(unsetCmd)
+}
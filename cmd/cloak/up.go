@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/injector"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	upProcfile   string
+	upOnly       []string
+	upEnvFor     []string
+	upKillOthers bool
+	upRedact     bool
+	upGrace      time.Duration
+)
+
+var upCmd = &cobra.Command{
+	Use:   "up [NAME...]",
+	Short: "Run the processes in a Procfile with secrets injected",
+	Long: `Starts every process in the Procfile (or only the NAMEs given) with secrets
+injected, decrypting the vault once for all of them. Output is prefixed with
+the process name, one color per process:
+
+  web: bun run dev
+  api: go run ./cmd/api
+  worker: go run ./cmd/worker
+
+Each process gets the selected environment unless told otherwise:
+  --only api=DATABASE_URL,REDIS_URL   inject only these keys into api
+  --env-for worker=staging            use another environment for worker
+
+Ctrl-C stops everything (see 'cloak run' for how processes are stopped). When
+a process exits the others keep running; --kill-others stops them too.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		procs, err := readProcfile(upProcfile)
+		if err != nil {
+			color.Red("Failed to read %s: %v", upProcfile, err)
+			os.Exit(1)
+		}
+		if len(args) > 0 {
+			for _, name := range args {
+				if !slices.ContainsFunc(procs, func(p procfileEntry) bool { return p.Name == name }) {
+					color.Red("Error: there is no process '%s' in %s.", name, upProcfile)
+					os.Exit(1)
+				}
+			}
+			procs = slices.DeleteFunc(procs, func(p procfileEntry) bool { return !slices.Contains(args, p.Name) })
+		}
+		if len(procs) == 0 {
+			color.Red("Error: %s has no processes.", upProcfile)
+			os.Exit(1)
+		}
+
+		only := perProcess(upOnly, "--only", procs)
+		envFor := perProcess(upEnvFor, "--env-for", procs)
+
+		// decrypt once, each environment that is used once
+		vault := loadVault(RequireKey())
+		secretsOf := make(map[string]map[string]string)
+		for _, p := range procs {
+			envName := currentEnv()
+			if e, ok := envFor[p.Name]; ok {
+				envName = e
+			}
+			if _, done := secretsOf[envName]; done {
+				continue
+			}
+			requireEnv(vault, envName)
+			secrets, err := vault.Resolve(envName)
+			if err != nil {
+				color.Red("Failed to resolve environment: %v", err)
+				os.Exit(1)
+			}
+			secretsOf[envName] = secrets
+			if upRedact {
+				warnUnredactable(secrets)
+			}
+		}
+
+		os.Exit(runProcesses(procs, func(p procfileEntry) (map[string]string, injector.Options) {
+			envName := currentEnv()
+			if e, ok := envFor[p.Name]; ok {
+				envName = e
+			}
+			var keys []string
+			if k, ok := only[p.Name]; ok {
+				keys = strings.Split(k, ",")
+			}
+			return secretsOf[envName], injector.Options{Only: keys, Redact: upRedact, GracePeriod: upGrace}
+		}))
+	},
+}
+
+type procfileEntry struct {
+	Name    string
+	Command string
+}
+
+// NAME: command lines as foreman and friends read them
+func readProcfile(path string) ([]procfileEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var procs []procfileEntry
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, command, ok := strings.Cut(text, ":")
+		name, command = strings.TrimSpace(name), strings.TrimSpace(command)
+		if !ok || name == "" || command == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("line %d: expected NAME: COMMAND", line)
+		}
+		if slices.ContainsFunc(procs, func(p procfileEntry) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("line %d: process '%s' is defined twice", line, name)
+		}
+		procs = append(procs, procfileEntry{Name: name, Command: command})
+	}
+	return procs, sc.Err()
+}
+
+// parses repeated NAME=VALUE flags, checking NAME is a process
+func perProcess(values []string, flag string, procs []procfileEntry) map[string]string {
+	out := make(map[string]string, len(values))
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || value == "" {
+			color.Red("Error: invalid %s '%s' (expected NAME=VALUE).", flag, v)
+			os.Exit(1)
+		}
+		if !slices.ContainsFunc(procs, func(p procfileEntry) bool { return p.Name == name }) {
+			color.Red("Error: %s %s: there is no process '%s'.", flag, v, name)
+			os.Exit(1)
+		}
+		out[name] = value
+	}
+	return out
+}
+
+var procColors = []color.Attribute{color.FgCyan, color.FgMagenta, color.FgGreen, color.FgYellow, color.FgBlue, color.FgHiCyan, color.FgHiMagenta, color.FgHiGreen}
+
+// runs procs until they have all exited and returns the status for cloak:
+// that of the first process that failed by itself, 130 after Ctrl-C
+func runProcesses(procs []procfileEntry, setup func(procfileEntry) (map[string]string, injector.Options)) int {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		color.Red("Failed to open %s: %v", os.DevNull, err)
+		return 1
+	}
+	defer devNull.Close()
+
+	width := 0
+	for _, p := range procs {
+		width = max(width, len(p.Name))
+	}
+
+	type exit struct {
+		name string
+		err  error
+	}
+	exits := make(chan exit, len(procs))
+	ctx, stopAll := context.WithCancel(context.Background())
+	defer stopAll()
+
+	var outMu sync.Mutex
+	for i, p := range procs {
+		paint := color.New(procColors[i%len(procColors)], color.Bold)
+		out := &prefixWriter{mu: &outMu, w: color.Output, prefix: paint.Sprintf("%-*s | ", width, p.Name)}
+
+		secrets, opts := setup(p)
+		opts.Stdin, opts.Stdout, opts.Stderr = devNull, out, out
+
+		command := []string{"sh", "-c", p.Command}
+		if runtime.GOOS == "windows" {
+			command = []string{"cmd", "/C", p.Command}
+		}
+
+		go func() {
+			err := injector.RunCommandContext(ctx, command, secrets, opts)
+			out.Flush()
+			exits <- exit{p.Name, err}
+		}()
+	}
+
+	status, stopping := 0, false
+	for running := len(procs); running > 0; {
+		select {
+		case <-sigs:
+			// every process gets it relayed by its own supervisor
+			if !stopping {
+				stopping = true
+				status = 130
+				color.Yellow("[CLOAK] Stopping %d process(es)...", running)
+			}
+		case e := <-exits:
+			running--
+			code, ok := commandStatus(e.err)
+			switch {
+			case !ok:
+				color.Red("[CLOAK] %s failed to start: %v", e.name, e.err)
+			case stopping:
+				continue
+			default:
+				color.Yellow("[CLOAK] %s exited with status %d", e.name, code)
+			}
+			if code != 0 && status == 0 {
+				status = code
+			}
+			if upKillOthers && !stopping && running > 0 {
+				stopping = true
+				color.Yellow("[CLOAK] Stopping the other %d process(es)...", running)
+				stopAll()
+			}
+		}
+	}
+	return status
+}
+
+// prefixWriter writes whole lines only, each starting with prefix, so the
+// output of several processes doesn't get mixed up mid-line
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := slices.Index(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// writes out a last line that didn't end in a newline
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	io.WriteString(p.w, p.prefix)
+	p.w.Write(line)
+}
+
+func init() {
+	upCmd.Flags().StringVarP(&upProcfile, "procfile", "f", "Procfile", "Procfile to read")
+	upCmd.Flags().StringArrayVar(&upOnly, "only", nil, "inject only these keys into a process (NAME=KEY,KEY..., repeatable)")
+	upCmd.Flags().StringArrayVar(&upEnvFor, "env-for", nil, "use another environment for a process (NAME=ENV, repeatable)")
+	upCmd.Flags().BoolVar(&upKillOthers, "kill-others", false, "stop all processes when one of them exits")
+	upCmd.Flags().BoolVar(&upRedact, "redact", false, "mask secret values in the output")
+	upCmd.Flags().DurationVar(&upGrace, "grace-period", injector.DefaultGracePeriod, "time processes get to exit after being stopped before they are killed")
+
+	rootCmd.AddCommand(upCmd)
+}
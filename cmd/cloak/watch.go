@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/injector"
+	"github.com/atomisadev/cloak/pkg/store"
+	"github.com/fatih/color"
+)
+
+var (
+	runWatch         bool
+	runWatchPaths    []string
+	runDebounce      time.Duration
+	runRestartOnExit bool
+)
+
+const (
+	watchInterval = 250 * time.Millisecond
+
+	restartBackoffMin = time.Second
+	restartBackoffMax = 30 * time.Second
+	// a command that ran this long before exiting isn't crash looping
+	restartStableAfter = 10 * time.Second
+)
+
+// run --watch / --restart-on-exit: keeps the command running, restarting
+// it with fresh secrets when the vault (or a watched file) changes and, if
+// asked to, when it exits. returns the exit status for cloak
+func runSupervised(args []string) int {
+	masterKey := RequireKey()
+	envName := currentEnv()
+	secrets := injectionSecrets(masterKey, args)
+
+	var changes <-chan []string
+	if runWatch || len(runWatchPaths) > 0 {
+		changes = watchFiles(append([]string{"cloak.encrypted"}, runWatchPaths...), runDebounce)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	cyan := color.New(color.FgCyan, color.Bold)
+
+	// picks up new secrets; on failure the caller keeps what it has
+	reload := func(changed []string) bool {
+		fresh, err := reloadSecrets(masterKey, envName)
+		if err != nil {
+			color.Red("[CLOAK] %s changed but the vault can't be loaded: %v", strings.Join(changed, ", "), err)
+			return false
+		}
+		secrets = fresh
+		cyan.Printf("[CLOAK] %s changed, restarting %s\n", strings.Join(changed, ", "), strings.Join(args, " "))
+		return true
+	}
+
+	backoff := restartBackoffMin
+	for {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		started := time.Now()
+		go func() { done <- injector.RunCommandContext(ctx, args, secrets, runOpts) }()
+
+		var err error
+		stopping, restart := false, false
+	running:
+		for {
+			select {
+			case changed := <-changes:
+				if reload(changed) {
+					restart = true
+					// stops the command the same way Ctrl-C does
+					cancel()
+				}
+			case <-sigs:
+				// the supervisor passes it on to the command, we just
+				// mustn't start it again
+				stopping = true
+			case err = <-done:
+				break running
+			}
+		}
+		cancel()
+
+		code, ok := commandStatus(err)
+		if stopping {
+			return code
+		}
+		if restart {
+			backoff = restartBackoffMin
+			continue
+		}
+		if interrupted(err) {
+			return code
+		}
+		if !ok {
+			color.Red("Command execution failed: %v", err)
+		} else if runRestartOnExit {
+			if time.Since(started) >= restartStableAfter {
+				backoff = restartBackoffMin
+			}
+			color.Yellow("[CLOAK] %s exited with status %d, restarting in %s", args[0], code, backoff)
+
+			select {
+			case <-time.After(backoff):
+				backoff = min(backoff*2, restartBackoffMax)
+			case changed := <-changes:
+				reload(changed)
+				backoff = restartBackoffMin
+			case <-sigs:
+				return code
+			}
+			continue
+		}
+
+		if changes == nil {
+			return code
+		}
+		if ok {
+			color.Yellow("[CLOAK] %s exited with status %d, waiting for changes", args[0], code)
+		} else {
+			color.Yellow("[CLOAK] Waiting for changes")
+		}
+		for waiting := true; waiting; {
+			select {
+			case changed := <-changes:
+				waiting = !reload(changed)
+			case <-sigs:
+				return code
+			}
+		}
+	}
+}
+
+// the status cloak exits with for err from RunCommand. ok is false when the
+// command didn't run at all
+func commandStatus(err error) (code int, ok bool) {
+	if err == nil {
+		return 0, true
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitCode(exitErr), true
+	}
+	return 1, false
+}
+
+// whether the command ended because someone asked it to: killed by (or
+// exiting with the conventional status for) SIGINT, SIGTERM or SIGHUP
+func interrupted(err error) bool {
+	code, ok := commandStatus(err)
+	if !ok {
+		return false
+	}
+	switch code {
+	case 128 + int(syscall.SIGINT), 128 + int(syscall.SIGTERM), 128 + int(syscall.SIGHUP):
+		return true
+	}
+	return false
+}
+
+// loadVault and requireEnv without exiting: a vault that is halfway through
+// a git merge shouldn't take the running command down with it
+func reloadSecrets(masterKey, envName string) (map[string]string, error) {
+	vault, err := store.Load("cloak.encrypted", masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := vault.Chain(envName)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range chain {
+		env, _ := vault.Env(n)
+		if !env.Locked() {
+			continue
+		}
+		key := envKey(n)
+		if key == "" {
+			return nil, fmt.Errorf("environment '%s' is sealed with its own key", n)
+		}
+		if err := env.Unlock(key); err != nil {
+			return nil, fmt.Errorf("unlocking environment '%s': %w", n, err)
+		}
+	}
+
+	return vault.Resolve(envName)
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// polls the files matching patterns and sends the paths that changed
+// (created, modified or removed) once nothing has changed for debounce.
+// polling keeps it dependency free and works the same everywhere, including
+// editors that save by renaming over the file
+func watchFiles(patterns []string, debounce time.Duration) <-chan []string {
+	out := make(chan []string)
+
+	go func() {
+		last := snapshot(patterns)
+		pending := make(map[string]bool)
+		var lastChange time.Time
+
+		tick := time.NewTicker(watchInterval)
+		defer tick.Stop()
+
+		for range tick.C {
+			cur := snapshot(patterns)
+			for p, st := range cur {
+				if old, ok := last[p]; !ok || old != st {
+					pending[p] = true
+					lastChange = time.Now()
+				}
+			}
+			for p := range last {
+				if _, ok := cur[p]; !ok {
+					pending[p] = true
+					lastChange = time.Now()
+				}
+			}
+			last = cur
+
+			if len(pending) > 0 && time.Since(lastChange) >= debounce {
+				out <- slices.Sorted(maps.Keys(pending))
+				clear(pending)
+			}
+		}
+	}()
+	return out
+}
+
+func snapshot(patterns []string) map[string]fileStamp {
+	files := make(map[string]fileStamp)
+
+	var globs []string
+	for _, p := range patterns {
+		p = path.Clean(filepath.ToSlash(p))
+		if !strings.ContainsAny(p, "*?[") {
+			if info, err := os.Stat(p); err == nil {
+				files[p] = fileStamp{info.ModTime(), info.Size()}
+			}
+			continue
+		}
+		globs = append(globs, p)
+	}
+	if len(globs) == 0 {
+		return files
+	}
+
+	filepath.WalkDir(".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != "." && (d.Name() == ".git" || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := filepath.ToSlash(p)
+		for _, g := range globs {
+			if matchGlob(g, name) {
+				if info, err := d.Info(); err == nil {
+					files[name] = fileStamp{info.ModTime(), info.Size()}
+				}
+				break
+			}
+		}
+		return nil
+	})
+	return files
+}
+
+// path.Match, plus ** for any number of directories
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
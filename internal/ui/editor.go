@@ -3,7 +3,10 @@ package ui
 import (
 	"fmt"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/atomisadev/cloak/pkg/store"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -55,28 +58,32 @@ const (
 	StateEditingValue
 	StateAddingKey
 	StateConfirmDelete
+	StateHistory
 )
 
 type KeyValue struct {
 	Key   string
 	Value string
+	Meta  store.SecretMeta
 }
 
 type Model struct {
-	State      AppState
-	Table      table.Model
-	Input      textinput.Model
-	Secrets    []KeyValue
-	ShowValues bool
-	ColFocus   int
-	ToSave     map[string]string
-	Quitting   bool
+	State        AppState
+	Table        table.Model
+	HistoryTable table.Model
+	Input        textinput.Model
+	Secrets      []KeyValue
+	History      map[string][]store.Version
+	ShowValues   bool
+	ColFocus     int
+	ToSave       map[string]string
+	Quitting     bool
 }
 
-func InitialModel(secrets map[string]string) Model {
+func InitialModel(env *store.Environment) Model {
 	var data []KeyValue
-	for k, v := range secrets {
-		data = append(data, KeyValue{Key: k, Value: v})
+	for k, v := range env.Secrets {
+		data = append(data, KeyValue{Key: k, Value: v, Meta: env.MetaOf(k)})
 	}
 	sort.Slice(data, func(i, j int) bool {
 		return data[i].Key < data[j].Key
@@ -85,6 +92,10 @@ func InitialModel(secrets map[string]string) Model {
 	columns := []table.Column{
 		{Title: "KEY", Width: 20},
 		{Title: "VALUE (Masked)", Width: 30},
+		{Title: "UPDATED", Width: 16},
+		{Title: "BY", Width: 18},
+		{Title: "TAGS", Width: 14},
+		{Title: "DESCRIPTION", Width: 28},
 	}
 
 	t := table.New(
@@ -99,18 +110,31 @@ func InitialModel(secrets map[string]string) Model {
 	s.Cell = lipgloss.NewStyle().Padding(0, 1)
 	t.SetStyles(s)
 
+	ht := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "VERSION", Width: 8},
+			{Title: "UPDATED", Width: 16},
+			{Title: "BY", Width: 18},
+			{Title: "VALUE", Width: 40},
+		}),
+		table.WithHeight(10),
+	)
+	ht.SetStyles(s)
+
 	ti := textinput.New()
 	ti.CharLimit = 2048
 	ti.Width = 50
 	ti.TextStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(NeonPink))
 
 	m := Model{
-		State:      StateBrowsing,
-		Table:      t,
-		Input:      ti,
-		Secrets:    data,
-		ShowValues: false,
-		ColFocus:   1,
+		State:        StateBrowsing,
+		Table:        t,
+		HistoryTable: ht,
+		Input:        ti,
+		Secrets:      data,
+		History:      env.History,
+		ShowValues:   false,
+		ColFocus:     1,
 	}
 	m.updateTableRows()
 	return m
@@ -123,11 +147,46 @@ func (m *Model) updateTableRows() {
 		if m.ShowValues {
 			valDisplay = s.Value
 		}
-		rows = append(rows, table.Row{s.Key, valDisplay})
+		rows = append(rows, table.Row{s.Key, valDisplay, formatTime(s.Meta.Updated), orDash(s.Meta.ModifiedBy), orDash(strings.Join(s.Meta.Tags, ",")), s.Meta.Description})
 	}
 	m.Table.SetRows(rows)
 }
 
+func (m *Model) updateHistoryRows() {
+	var rows []table.Row
+	for i, v := range m.History[m.selectedKey()] {
+		valDisplay := "••••••••••••"
+		if m.ShowValues {
+			valDisplay = v.Value
+		}
+		rows = append(rows, table.Row{fmt.Sprint(i + 1), formatTime(v.Updated), orDash(v.ModifiedBy), valDisplay})
+	}
+	m.HistoryTable.SetRows(rows)
+	m.HistoryTable.SetCursor(0)
+}
+
+func (m Model) selectedKey() string {
+	row := m.Table.Cursor()
+	if row < 0 || row >= len(m.Secrets) {
+		return ""
+	}
+	return m.Secrets[row].Key
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "—"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
+
 func (m Model) Init() tea.Cmd {
 	return nil
 }
@@ -140,6 +199,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.Table.SetWidth(msg.Width - 4)
 		m.Table.SetHeight(msg.Height - 10)
+		m.HistoryTable.SetWidth(msg.Width - 4)
+		m.HistoryTable.SetHeight(msg.Height - 10)
 
 	case tea.KeyMsg:
 		switch m.State {
@@ -160,6 +221,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if len(m.Secrets) > 0 {
 					m.State = StateConfirmDelete
 				}
+			case "h":
+				if len(m.Secrets) > 0 {
+					m.State = StateHistory
+					m.updateHistoryRows()
+					m.HistoryTable.Focus()
+				}
 			case "a":
 				m.State = StateAddingKey
 				m.Input.Placeholder = "NEW_KEY_NAME"
@@ -238,6 +305,31 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case "n", "esc":
 				m.State = StateBrowsing
 			}
+
+		case StateHistory:
+			switch msg.String() {
+			case "enter", "r":
+				versions := m.History[m.selectedKey()]
+				i := m.HistoryTable.Cursor()
+				if i >= 0 && i < len(versions) {
+					m.Secrets[m.Table.Cursor()].Value = versions[i].Value
+					m.updateTableRows()
+				}
+				m.State = StateBrowsing
+				m.HistoryTable.Blur()
+			case "v", " ":
+				m.ShowValues = !m.ShowValues
+				m.updateTableRows()
+				cursor := m.HistoryTable.Cursor()
+				m.updateHistoryRows()
+				m.HistoryTable.SetCursor(cursor)
+			case "esc", "q", "h":
+				m.State = StateBrowsing
+				m.HistoryTable.Blur()
+			default:
+				m.HistoryTable, cmd = m.HistoryTable.Update(msg)
+			}
+			return m, cmd
 		}
 	}
 
@@ -254,13 +346,15 @@ func (m Model) View() string {
 	var status string
 	switch m.State {
 	case StateBrowsing:
-		status = fmt.Sprintf("ROWS: %d • [a] ADD • [d] DELETE • [v] TOGGLE VISIBILITY • [enter] EDIT • [ctrl+s] SAVE & QUIT", len(m.Secrets))
+		status = fmt.Sprintf("ROWS: %d • [a] ADD • [d] DELETE • [v] TOGGLE VISIBILITY • [h] HISTORY • [enter] EDIT • [ctrl+s] SAVE & QUIT", len(m.Secrets))
 	case StateEditingValue:
 		status = "EDITING VALUE • [enter] CONFIRM • [esc] CANCEL"
 	case StateAddingKey:
 		status = "NEW KEY NAME • [enter] CONFIRM • [esc] CANCEL"
 	case StateConfirmDelete:
 		status = lipgloss.NewStyle().Foreground(lipgloss.Color(AlertRed)).Render("DELETE SELECTED SECRET? (y/n)")
+	case StateHistory:
+		status = "HISTORY • [enter] RESTORE VERSION • [v] TOGGLE VISIBILITY • [esc] BACK"
 	}
 	status = dimmedStyle.Render(status)
 
@@ -276,6 +370,13 @@ func (m Model) View() string {
 			m.Input.View(),
 		)
 		content = inputPopupStyle.Render(inputView)
+	} else if m.State == StateHistory {
+		title := lipgloss.NewStyle().Foreground(lipgloss.Color(NeonCyan)).Render("HISTORY // " + m.selectedKey())
+		body := m.HistoryTable.View()
+		if len(m.History[m.selectedKey()]) == 0 {
+			body = dimmedStyle.Render("No previous versions kept. Enable with 'cloak history --keep N'.")
+		}
+		content = baseStyle.Render(lipgloss.JoinVertical(lipgloss.Left, title, body))
 	} else {
 		content = baseStyle.Render(m.Table.View())
 	}
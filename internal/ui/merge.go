@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/atomisadev/cloak/pkg/store"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type Resolution int
+
+const (
+	TakeOurs Resolution = iota
+	TakeTheirs
+	TakeBase
+)
+
+var (
+	sideStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color(MutedGray)).
+			Padding(0, 1).
+			Width(28)
+
+	chosenSideStyle = sideStyle.
+			BorderForeground(lipgloss.Color(NeonCyan))
+)
+
+// walks the user through the conflicts left by a three-way vault merge
+type MergeModel struct {
+	Conflicts  []store.Conflict
+	Choices    []Resolution
+	Cursor     int
+	ShowValues bool
+	Done       bool
+	Aborted    bool
+}
+
+func InitialMergeModel(conflicts []store.Conflict) MergeModel {
+	return MergeModel{
+		Conflicts: conflicts,
+		Choices:   make([]Resolution, len(conflicts)),
+	}
+}
+
+func (m MergeModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m MergeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+
+	switch keyMsg.String() {
+	case "q", "ctrl+c", "esc":
+		m.Aborted = true
+		return m, tea.Quit
+	case "ctrl+s":
+		m.Done = true
+		return m, tea.Quit
+	case "o":
+		m.Choices[m.Cursor] = TakeOurs
+		m.next()
+	case "t":
+		m.Choices[m.Cursor] = TakeTheirs
+		m.next()
+	case "b":
+		m.Choices[m.Cursor] = TakeBase
+		m.next()
+	case "right", "l", "j", "down", "tab":
+		m.next()
+	case "left", "h", "k", "up", "shift+tab":
+		if m.Cursor > 0 {
+			m.Cursor--
+		}
+	case "v", " ":
+		m.ShowValues = !m.ShowValues
+	}
+
+	return m, nil
+}
+
+func (m *MergeModel) next() {
+	if m.Cursor < len(m.Conflicts)-1 {
+		m.Cursor++
+	}
+}
+
+func (m MergeModel) View() string {
+	banner := lipgloss.NewStyle().Foreground(lipgloss.Color(NeonPink)).Bold(true).Render("CLOAK // MERGE CONFLICTS")
+
+	c := m.Conflicts[m.Cursor]
+	key := c.Key
+	if key == "" {
+		key = "(inherits)"
+	}
+	title := lipgloss.NewStyle().Foreground(lipgloss.Color(NeonCyan)).Render(
+		fmt.Sprintf("CONFLICT %d/%d • ENV %s • KEY %s", m.Cursor+1, len(m.Conflicts), c.Env, key),
+	)
+
+	sides := lipgloss.JoinHorizontal(lipgloss.Top,
+		m.renderSide("BASE [b]", c.Base, m.Choices[m.Cursor] == TakeBase, c.Key != ""),
+		m.renderSide("OURS [o]", c.Ours, m.Choices[m.Cursor] == TakeOurs, c.Key != ""),
+		m.renderSide("THEIRS [t]", c.Theirs, m.Choices[m.Cursor] == TakeTheirs, c.Key != ""),
+	)
+
+	status := dimmedStyle.Render("[o/t/b] PICK • [←/→] PREV/NEXT • [v] TOGGLE VISIBILITY • [ctrl+s] APPLY • [q] ABORT")
+
+	return lipgloss.JoinVertical(lipgloss.Center,
+		banner,
+		"\n",
+		title,
+		sides,
+		"\n",
+		status,
+	)
+}
+
+func (m MergeModel) renderSide(label string, value *string, chosen bool, secret bool) string {
+	display := "<absent>"
+	if value != nil {
+		display = *value
+		if secret && !m.ShowValues {
+			display = "••••••••••••"
+		}
+	}
+
+	style := sideStyle
+	if chosen {
+		style = chosenSideStyle
+	}
+
+	return style.Render(lipgloss.JoinVertical(lipgloss.Left,
+		headerStyle.Render(label),
+		display,
+	))
+}
+
+// the value picked for conflict i (nil means the key is removed)
+func (m MergeModel) Resolved(i int) *string {
+	c := m.Conflicts[i]
+	switch m.Choices[i] {
+	case TakeTheirs:
+		return c.Theirs
+	case TakeBase:
+		return c.Base
+	default:
+		return c.Ours
+	}
+}
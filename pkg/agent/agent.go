@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"errors"
+	"time"
+)
+
+// environment variable pointing cloak at a running agent, like SSH_AUTH_SOCK
+const SocketEnv = "CLOAK_AGENT_SOCK"
+
+// the agent doesn't hold the key of the asked-for vault (or it expired)
+var ErrNoKey = errors.New("agent: no key for this vault")
+
+// one JSON object per line, one request per connection
+type request struct {
+	Op    string        `json:"op"`
+	KeyID string        `json:"kid,omitempty"`
+	Key   string        `json:"key,omitempty"`
+	Label string        `json:"label,omitempty"`
+	Idle  time.Duration `json:"idle,omitempty"`
+}
+
+type response struct {
+	Error  string  `json:"error,omitempty"`
+	Key    string  `json:"key,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+type Status struct {
+	PID  int           `json:"pid"`
+	Idle time.Duration `json:"idle"`
+	Keys []KeyInfo     `json:"keys"`
+}
+
+// a key held by the agent. the key itself is never part of a status
+type KeyInfo struct {
+	KeyID   string    `json:"kid"`
+	Label   string    `json:"label,omitempty"`
+	Added   time.Time `json:"added"`
+	Expires time.Time `json:"expires,omitzero"`
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+const dialTimeout = time.Second
+
+type Client struct {
+	Path string
+}
+
+// the agent advertised in CLOAK_AGENT_SOCK, if any
+func FromEnv() (*Client, bool) {
+	path := os.Getenv(SocketEnv)
+	if path == "" {
+		return nil, false
+	}
+	return &Client{Path: path}, true
+}
+
+// the hex key of the vault with this key id
+func (c *Client) Get(keyID string) (string, error) {
+	resp, err := c.call(request{Op: "get", KeyID: keyID})
+	if err != nil {
+		return "", err
+	}
+	return resp.Key, nil
+}
+
+// hands the agent a key. label says where it came from (a project path) and
+// idle overrides the agent's default idle timeout when non-zero
+func (c *Client) Add(keyID, key, label string, idle time.Duration) error {
+	_, err := c.call(request{Op: "add", KeyID: keyID, Key: key, Label: label, Idle: idle})
+	return err
+}
+
+// makes the agent forget every key
+func (c *Client) Lock() error {
+	_, err := c.call(request{Op: "lock"})
+	return err
+}
+
+func (c *Client) Status() (*Status, error) {
+	resp, err := c.call(request{Op: "status"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+// shuts the agent down, wiping its keys
+func (c *Client) Stop() error {
+	_, err := c.call(request{Op: "stop"})
+	return err
+}
+
+func (c *Client) call(req request) (*response, error) {
+	conn, err := net.DialTimeout("unix", c.Path, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		if resp.Error == ErrNoKey.Error() {
+			return nil, ErrNoKey
+		}
+		return nil, errors.New("agent: " + resp.Error)
+	}
+	return &resp, nil
+}
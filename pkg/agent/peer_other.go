@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package agent
+
+import "net"
+
+// no portable way to ask; the 0600 socket in a 0700 directory has to do
+func checkPeer(conn net.Conn, uid int) error {
+	return nil
+}
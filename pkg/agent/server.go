@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+)
+
+const connTimeout = 5 * time.Second
+
+// Server keeps vault keys, indexed by key id, in locked memory until they
+// have gone unused for their idle timeout
+type Server struct {
+	// default idle timeout for keys; zero keeps them until locked
+	Idle time.Duration
+
+	// the user every peer has to run as
+	uid int
+
+	mu   sync.Mutex
+	keys map[string]*entry
+	done chan struct{}
+	once sync.Once
+}
+
+type entry struct {
+	key     *crypto.SecureBuffer
+	label   string
+	idle    time.Duration
+	added   time.Time
+	expires time.Time
+}
+
+func NewServer(idle time.Duration) *Server {
+	return &Server{Idle: idle, uid: os.Getuid(), keys: make(map[string]*entry), done: make(chan struct{})}
+}
+
+// creates the socket, readable and writable by the current user only. a
+// socket left behind by an agent that died is replaced
+func Listen(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if _, err := (&Client{Path: path}).Status(); err == nil {
+			return nil, fmt.Errorf("an agent is already listening on %s", path)
+		}
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// answers requests until Close (or a stop request) and wipes all keys on
+// the way out
+func (s *Server) Serve(l net.Listener) error {
+	go s.expireLoop()
+	go func() {
+		<-s.done
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil
+			default:
+			}
+			if errors.Is(err, net.ErrClosed) {
+				s.Close()
+				return nil
+			}
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.Lock()
+	})
+}
+
+// forgets every key
+func (s *Server) Lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, e := range s.keys {
+		e.key.Destroy()
+		delete(s.keys, id)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connTimeout))
+
+	if err := checkPeer(conn, s.uid); err != nil {
+		log.Printf("agent: rejected connection: %v", err)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+
+	resp := s.serve(req)
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func (s *Server) serve(req request) response {
+	switch req.Op {
+	case "get":
+		key, err := s.get(req.KeyID)
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		return response{Key: key}
+	case "add":
+		if err := s.add(req); err != nil {
+			return response{Error: err.Error()}
+		}
+		return response{}
+	case "lock":
+		s.Lock()
+		return response{}
+	case "status":
+		return response{Status: s.status()}
+	case "stop":
+		go s.Close()
+		return response{}
+	}
+	return response{Error: fmt.Sprintf("unknown request '%s'", req.Op)}
+}
+
+func (s *Server) get(keyID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.keys[keyID]
+	if !ok {
+		return "", ErrNoKey
+	}
+	if e.idle > 0 {
+		e.expires = time.Now().Add(e.idle)
+	}
+	return hex.EncodeToString(e.key.Bytes()), nil
+}
+
+func (s *Server) add(req request) error {
+	raw, err := hex.DecodeString(req.Key)
+	if err != nil || req.KeyID == "" {
+		return errors.New("invalid key")
+	}
+	if crypto.KeyID(raw) != req.KeyID {
+		clear(raw)
+		return fmt.Errorf("key doesn't match key id %s", req.KeyID)
+	}
+	// raw is wiped by the copy
+	key := crypto.SecureBytes(raw)
+
+	idle := req.Idle
+	if idle == 0 {
+		idle = s.Idle
+	}
+	e := &entry{key: key, label: req.Label, idle: idle, added: time.Now()}
+	if idle > 0 {
+		e.expires = e.added.Add(idle)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.keys[req.KeyID]; ok {
+		old.key.Destroy()
+	}
+	s.keys[req.KeyID] = e
+	return nil
+}
+
+func (s *Server) status() *Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &Status{PID: os.Getpid(), Idle: s.Idle, Keys: []KeyInfo{}}
+	for _, id := range slices.Sorted(maps.Keys(s.keys)) {
+		e := s.keys[id]
+		st.Keys = append(st.Keys, KeyInfo{KeyID: id, Label: e.label, Added: e.added, Expires: e.expires})
+	}
+	return st
+}
+
+func (s *Server) expireLoop() {
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-tick.C:
+			s.mu.Lock()
+			for id, e := range s.keys {
+				if !e.expires.IsZero() && now.After(e.expires) {
+					e.key.Destroy()
+					delete(s.keys, id)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
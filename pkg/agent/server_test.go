@@ -0,0 +1,197 @@
+//go:build linux || darwin
+
+package agent
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+)
+
+// an agent on a socket in a fresh directory. the directory is kept short
+// since socket paths are limited to about 100 bytes
+func startAgent(t *testing.T, idle time.Duration) (*Server, *Client) {
+	t.Helper()
+	return startAgentAs(t, idle, os.Getuid())
+}
+
+// like startAgent, with an agent that only accepts peers running as uid
+func startAgentAs(t *testing.T, idle time.Duration, uid int) (*Server, *Client) {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "cloak-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "agent.sock")
+	l, err := Listen(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(idle)
+	s.uid = uid
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-served; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return s, &Client{Path: path}
+}
+
+func testKey(t *testing.T) (keyID, key string) {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := hex.DecodeString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crypto.KeyID(raw), key
+}
+
+func TestAgentAddGetLock(t *testing.T) {
+	_, c := startAgent(t, 0)
+	id, key := testKey(t)
+
+	if _, err := c.Get(id); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("get before add: got %v, want ErrNoKey", err)
+	}
+	if err := c.Add(id, key, "/src/app", 0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != key {
+		t.Fatalf("got key %s, want %s", got, key)
+	}
+
+	st, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Keys) != 1 || st.Keys[0].KeyID != id || st.Keys[0].Label != "/src/app" {
+		t.Fatalf("status = %+v", st.Keys)
+	}
+
+	if err := c.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(id); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("get after lock: got %v, want ErrNoKey", err)
+	}
+
+	// locking only forgets keys; the agent takes new ones straight away
+	if err := c.Add(id, key, "/src/app", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(id); err != nil {
+		t.Fatalf("get after adding again: %v", err)
+	}
+}
+
+func TestAgentRejectsMismatchedKey(t *testing.T) {
+	_, c := startAgent(t, 0)
+	id, _ := testKey(t)
+	_, other := testKey(t)
+
+	if err := c.Add(id, other, "", 0); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Fatalf("got %v, want a key id mismatch", err)
+	}
+	if err := c.Add(id, "not hex", "", 0); err == nil {
+		t.Fatal("accepted a key that isn't hex")
+	}
+}
+
+func TestAgentIdleExpiry(t *testing.T) {
+	_, c := startAgent(t, time.Hour)
+	short, shortKey := testKey(t)
+	long, longKey := testKey(t)
+
+	// a per-key idle timeout overrides the agent's
+	if err := c.Add(short, shortKey, "", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(long, longKey, "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// expiry runs once a second
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		_, err := c.Get(short)
+		if errors.Is(err, ErrNoKey) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("idle key never expired")
+		}
+		// asking for the key resets its timer, so wait it out between tries
+		time.Sleep(300 * time.Millisecond)
+	}
+
+	if _, err := c.Get(long); err != nil {
+		t.Fatalf("key with the agent's idle timeout: %v", err)
+	}
+}
+
+func TestAgentRejectsOtherUsers(t *testing.T) {
+	s, c := startAgentAs(t, 0, os.Getuid()+1)
+	id, key := testKey(t)
+	if err := s.add(request{KeyID: id, Key: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the agent hangs up without answering
+	if _, err := c.Get(id); err == nil || errors.Is(err, ErrNoKey) {
+		t.Fatalf("get: got %v, want the connection to be dropped", err)
+	}
+	if err := c.Add(id, key, "", 0); err == nil {
+		t.Fatal("add from another user was accepted")
+	}
+}
+
+func TestAgentStop(t *testing.T) {
+	_, c := startAgent(t, 0)
+
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := c.Status(); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("agent still answering after stop")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListenRefusesNonSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(path); err == nil {
+		t.Fatal("Listen replaced a regular file")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -14,14 +15,15 @@ import (
 // prepends random nonce to ciphertext
 // returns byte slice containing: [nonce | ciphertext + tag ]
 func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("crypto: failed to create cipher block: %w", err)
-	}
+	return EncryptWithAD(plaintext, key, nil)
+}
 
-	gcm, err := cipher.NewGCM(block)
+// same as Encrypt, but also authenticates the associated data
+// (ad is not included in the output and must be supplied again to decrypt)
+func EncryptWithAD(plaintext []byte, key []byte, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("crypto: failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
@@ -30,38 +32,81 @@ func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
 	}
 
 	// encrypt and authenticate
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, ad)
 
 	return ciphertext, nil
 }
 
 // decrypts the data using aes-256-gcm
 func Decrypt(data []byte, key []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("crypto: failed to create cipher block: %w", err)
-	}
+	return DecryptWithAD(data, key, nil)
+}
 
-	gcm, err := cipher.NewGCM(block)
+// decrypts data produced by EncryptWithAD, verifying the associated data
+func DecryptWithAD(data []byte, key []byte, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
-		return nil, fmt.Errorf("crypto: failed to create GCM: %w", err)
+		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
-		return nil, errors.New("crypto: ciphertext too short (invalid format)")
+		return nil, errTooShort
 	}
 
 	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, ad)
 	if err != nil {
-		return nil, errors.New("crypto: destination failed (auth tag mismatch or corrupted data)")
+		return nil, errAuth
 	}
 
 	return plaintext, nil
 }
 
+// same as DecryptWithAD, but the plaintext never touches the Go heap: it is
+// decrypted straight into a SecureBuffer, which the caller must Destroy
+func DecryptSecure(data []byte, key []byte, ad []byte) (*SecureBuffer, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize+gcm.Overhead() {
+		return nil, errTooShort
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+
+	// sized exactly, so Open writes into it instead of allocating
+	buf := NewSecureBuffer(len(ciphertext) - gcm.Overhead())
+	if _, err := gcm.Open(buf.Bytes()[:0], nonce, ciphertext, ad); err != nil {
+		buf.Destroy()
+		return nil, errAuth
+	}
+
+	return buf, nil
+}
+
+var (
+	errTooShort = errors.New("crypto: ciphertext too short (invalid format)")
+	errAuth     = errors.New("crypto: destination failed (auth tag mismatch or corrupted data)")
+)
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: failed to create cipher block: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
 func GenerateKey() (string, error) {
 	bytes := make([]byte, 32)
 	if _, err := io.ReadFull(rand.Reader, bytes); err != nil {
@@ -69,3 +114,10 @@ func GenerateKey() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+// short, non-secret fingerprint of a key (first 8 bytes of its sha256)
+// used to tell which key a vault was sealed with
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
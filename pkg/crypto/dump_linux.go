@@ -0,0 +1,12 @@
+package crypto
+
+import "golang.org/x/sys/unix"
+
+// DisableCoreDumps keeps decrypted secrets out of core files by making the
+// process non-dumpable, which also keeps other processes of the same user
+// from attaching to it or reading its memory through /proc. unlike a core
+// rlimit it isn't inherited: commands cloak starts are dumpable again
+// after their exec
+func DisableCoreDumps() error {
+	return unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0)
+}
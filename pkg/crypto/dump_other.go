@@ -0,0 +1,10 @@
+//go:build !linux
+
+package crypto
+
+// DisableCoreDumps keeps decrypted secrets out of core files. elsewhere the
+// only switch is the core rlimit, which commands cloak starts would inherit,
+// so this leaves things as they are
+func DisableCoreDumps() error {
+	return nil
+}
@@ -0,0 +1,53 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const KDFArgon2id = "argon2id"
+
+// salt and cost parameters needed to re-derive a passphrase key.
+// these are not secret and live in the vault header
+type KDFParams struct {
+	Algorithm string `json:"alg"`
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"t"`
+	Memory    uint32 `json:"m"` // KiB
+	Threads   uint8  `json:"p"`
+}
+
+// fresh Argon2id parameters with a random salt.
+// costs follow the RFC 9106 second recommended option (64 MiB, 3 passes)
+func NewKDFParams() (*KDFParams, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("crypto: failed to generate salt: %w", err)
+	}
+
+	return &KDFParams{
+		Algorithm: KDFArgon2id,
+		Salt:      salt,
+		Time:      3,
+		Memory:    64 * 1024,
+		Threads:   4,
+	}, nil
+}
+
+// derives a 32 byte key from the passphrase, hex encoded like GenerateKey
+func DeriveKey(passphrase string, p *KDFParams) (string, error) {
+	if p == nil || p.Algorithm != KDFArgon2id {
+		return "", errors.New("crypto: unsupported key derivation function")
+	}
+	if len(p.Salt) == 0 || p.Time == 0 || p.Memory == 0 || p.Threads == 0 {
+		return "", errors.New("crypto: invalid key derivation parameters")
+	}
+
+	key := argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, 32)
+	return hex.EncodeToString(key), nil
+}
@@ -0,0 +1,107 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const wrapInfo = "cloak/x25519/v1"
+
+// generates an X25519 key pair for a user.
+// the identity (private key) stays in the keychain, the recipient
+// (public key) is what gets shared and added to vaults
+func GenerateIdentity() (identity string, recipient string, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("crypto: failed to generate identity: %w", err)
+	}
+	return hex.EncodeToString(priv.Bytes()), hex.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+// returns the public recipient key belonging to an identity
+func RecipientOf(identity string) (string, error) {
+	priv, err := parseIdentity(identity)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+// encrypts fileKey for the recipient using an ephemeral X25519 exchange.
+// returns the ephemeral public key and the wrapped key
+func WrapKey(fileKey []byte, recipient string) ([]byte, []byte, error) {
+	pubBytes, err := hex.DecodeString(recipient)
+	if err != nil {
+		return nil, nil, fmt.Errorf("crypto: invalid recipient: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(pubBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("crypto: invalid recipient: %w", err)
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("crypto: failed to generate ephemeral key: %w", err)
+	}
+
+	wrapKey, err := deriveWrapKey(ephemeral, pub, ephemeral.PublicKey().Bytes(), pubBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrapped, err := Encrypt(fileKey, wrapKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ephemeral.PublicKey().Bytes(), wrapped, nil
+}
+
+// recovers a file key wrapped with WrapKey using the recipient's identity
+func UnwrapKey(ephemeralKey []byte, wrapped []byte, identity string) ([]byte, error) {
+	priv, err := parseIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	epk, err := ecdh.X25519().NewPublicKey(ephemeralKey)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: invalid ephemeral key: %w", err)
+	}
+
+	wrapKey, err := deriveWrapKey(priv, epk, ephemeralKey, priv.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return Decrypt(wrapped, wrapKey)
+}
+
+// shared secret -> wrapping key. the salt binds both public keys so a
+// wrapped key can't be replayed against a different recipient
+func deriveWrapKey(priv *ecdh.PrivateKey, peer *ecdh.PublicKey, ephemeralKey []byte, recipientKey []byte) ([]byte, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: key exchange failed: %w", err)
+	}
+
+	salt := append(append([]byte{}, ephemeralKey...), recipientKey...)
+	return hkdf.Key(sha256.New, shared, salt, wrapInfo, 32)
+}
+
+func parseIdentity(identity string) (*ecdh.PrivateKey, error) {
+	raw, err := hex.DecodeString(identity)
+	if err != nil {
+		return nil, errors.New("crypto: invalid identity format")
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: invalid identity: %w", err)
+	}
+	return priv, nil
+}
@@ -0,0 +1,72 @@
+package crypto
+
+// SecureBuffer holds secret bytes outside the Go heap, in memory that is
+// locked so it never ends up in swap (where the OS lets us; otherwise it is
+// just wiped). the garbage collector never copies it around, and Destroy
+// zeroes it before giving it back
+type SecureBuffer struct {
+	mem    []byte
+	locked bool
+}
+
+// a zeroed buffer of size bytes
+func NewSecureBuffer(size int) *SecureBuffer {
+	b := &SecureBuffer{}
+	if size > 0 {
+		b.mem, b.locked = allocLocked(size)
+	}
+	return b
+}
+
+// copies b into a new buffer and wipes b
+func SecureBytes(b []byte) *SecureBuffer {
+	s := NewSecureBuffer(len(b))
+	copy(s.mem, b)
+	clear(b)
+	return s
+}
+
+// copies s into a new buffer. s itself can't be wiped
+func SecureString(s string) *SecureBuffer {
+	b := NewSecureBuffer(len(s))
+	copy(b.mem, s)
+	return b
+}
+
+// the contents, valid until Destroy
+func (b *SecureBuffer) Bytes() []byte {
+	return b.mem
+}
+
+func (b *SecureBuffer) Len() int {
+	return len(b.mem)
+}
+
+// whether the memory is actually locked
+func (b *SecureBuffer) Locked() bool {
+	return b.locked
+}
+
+// a copy of the contents as a string, for APIs that need one. the copy is
+// ordinary heap memory, so keep these short-lived
+func (b *SecureBuffer) Reveal() string {
+	return string(b.mem)
+}
+
+// zeroes the contents but keeps the buffer
+func (b *SecureBuffer) Wipe() {
+	clear(b.mem)
+}
+
+// zeroes and releases the buffer. safe to call more than once
+func (b *SecureBuffer) Destroy() {
+	if b == nil || b.mem == nil {
+		return
+	}
+	clear(b.mem)
+	release(b.mem, b.locked)
+	b.mem, b.locked = nil, false
+}
+
+// swapped out in tests to look at the memory before it's gone
+var release = freeLocked
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package crypto
+
+// no mlock here; the buffer is at least wiped when it's destroyed
+func allocLocked(size int) ([]byte, bool) {
+	return make([]byte, size), false
+}
+
+func freeLocked(mem []byte, locked bool) {}
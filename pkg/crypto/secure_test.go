@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+// records what Destroy hands back, checking it was zeroed first
+func watchRelease(t *testing.T) *int {
+	t.Helper()
+	released := 0
+	release = func(mem []byte, locked bool) {
+		if !bytes.Equal(mem, make([]byte, len(mem))) {
+			t.Errorf("buffer released without being zeroed: %q", mem)
+		}
+		released++
+		freeLocked(mem, locked)
+	}
+	t.Cleanup(func() { release = freeLocked })
+	return &released
+}
+
+func TestSecureBufferWipe(t *testing.T) {
+	b := SecureString("hunter2")
+	defer b.Destroy()
+
+	if got := string(b.Bytes()); got != "hunter2" {
+		t.Fatalf("Bytes() = %q, want %q", got, "hunter2")
+	}
+	b.Wipe()
+	if !bytes.Equal(b.Bytes(), make([]byte, 7)) {
+		t.Fatalf("Wipe left %q", b.Bytes())
+	}
+	if b.Len() != 7 {
+		t.Fatalf("Wipe changed the length to %d", b.Len())
+	}
+}
+
+func TestSecureBytesWipesSource(t *testing.T) {
+	src := []byte("hunter2")
+	b := SecureBytes(src)
+	defer b.Destroy()
+
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Fatalf("source left as %q", src)
+	}
+	if got := string(b.Bytes()); got != "hunter2" {
+		t.Fatalf("Bytes() = %q, want %q", got, "hunter2")
+	}
+}
+
+func TestSecureBufferDestroy(t *testing.T) {
+	released := watchRelease(t)
+
+	b := SecureString("hunter2")
+	b.Destroy()
+	if *released != 1 {
+		t.Fatalf("released %d times, want 1", *released)
+	}
+	if b.Bytes() != nil || b.Len() != 0 || b.Locked() {
+		t.Fatalf("destroyed buffer still holds %d bytes", b.Len())
+	}
+
+	// a second Destroy, an empty buffer and a nil one are all no-ops
+	b.Destroy()
+	NewSecureBuffer(0).Destroy()
+	var nilBuf *SecureBuffer
+	nilBuf.Destroy()
+	if *released != 1 {
+		t.Fatalf("released %d times, want 1", *released)
+	}
+}
+
+func TestDecryptSecure(t *testing.T) {
+	released := watchRelease(t)
+	key := bytes.Repeat([]byte{7}, 32)
+
+	ct, err := EncryptWithAD([]byte("hunter2"), key, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := DecryptSecure(ct, key, []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b.Bytes()); got != "hunter2" {
+		t.Fatalf("decrypted %q, want %q", got, "hunter2")
+	}
+	b.Destroy()
+
+	// wrong associated data: the buffer Open wrote into must be released
+	*released = 0
+	if b, err := DecryptSecure(ct, key, []byte("other")); err == nil || b != nil {
+		t.Fatalf("DecryptSecure with the wrong ad = %v, %v", b, err)
+	}
+	if *released != 1 {
+		t.Fatalf("failed decryption released %d buffers, want 1", *released)
+	}
+
+	if _, err := DecryptSecure(ct[:8], key, nil); err == nil {
+		t.Fatal("DecryptSecure accepted a truncated ciphertext")
+	}
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package crypto
+
+import "golang.org/x/sys/unix"
+
+// a private anonymous mapping, locked if RLIMIT_MEMLOCK allows. falls back
+// to the heap if there's no mapping to be had
+func allocLocked(size int) ([]byte, bool) {
+	mem, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return make([]byte, size), false
+	}
+	return mem, unix.Mlock(mem) == nil
+}
+
+func freeLocked(mem []byte, locked bool) {
+	if locked {
+		unix.Munlock(mem)
+	}
+	// heap fallbacks aren't mapped; Munmap just fails for them
+	unix.Munmap(mem)
+}
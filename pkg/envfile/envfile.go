@@ -0,0 +1,313 @@
+package envfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// formats Parse understands
+var ParseFormats = []string{"dotenv", "json", "yaml", "docker"}
+
+// formats Format can write
+var FormatFormats = []string{"dotenv", "json", "yaml", "shell-export"}
+
+// guesses the format from the file name; anything unknown is treated as dotenv.
+// docker env-files look like dotenv files and have to be asked for explicitly
+func DetectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "dotenv"
+}
+
+func Parse(format string, data []byte) (map[string]string, error) {
+	switch format {
+	case "dotenv":
+		return parseDotenv(data)
+	case "json":
+		return parseJSON(data)
+	case "yaml":
+		return parseYAML(data)
+	case "docker":
+		return parseDocker(data)
+	}
+	return nil, fmt.Errorf("unsupported format '%s' (use %s)", format, strings.Join(ParseFormats, ", "))
+}
+
+func Format(format string, secrets map[string]string) ([]byte, error) {
+	keys := slices.Sorted(maps.Keys(secrets))
+
+	switch format {
+	case "dotenv":
+		var b bytes.Buffer
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s=%s\n", k, quoteDotenv(secrets[k]))
+		}
+		return b.Bytes(), nil
+	case "shell-export":
+		var b bytes.Buffer
+		for _, k := range keys {
+			if !isShellName(k) {
+				return nil, fmt.Errorf("'%s' is not a valid shell variable name", k)
+			}
+			fmt.Fprintf(&b, "export %s=%s\n", k, quoteShell(secrets[k]))
+		}
+		return b.Bytes(), nil
+	case "json":
+		out, err := json.MarshalIndent(secrets, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	case "yaml":
+		return yaml.Marshal(secrets)
+	}
+	return nil, fmt.Errorf("unsupported format '%s' (use %s)", format, strings.Join(FormatFormats, ", "))
+}
+
+// KEY=value lines as read by dotenv libraries: optional 'export ' prefix,
+// # comments, single quotes (literal), double quotes (escapes, may span
+// lines) and unquoted values with trailing comments
+func parseDotenv(data []byte) (map[string]string, error) {
+	out := make(map[string]string)
+	src := strings.ReplaceAll(string(data), "\r\n", "\n")
+	src = strings.TrimPrefix(src, "\ufeff")
+
+	line := 1
+	for len(src) > 0 {
+		var raw string
+		raw, src, _ = strings.Cut(src, "\n")
+		start := line
+		line++
+
+		trimmed := strings.TrimSpace(raw)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(trimmed, "export"); ok && (strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "\t")) {
+			trimmed = strings.TrimSpace(rest)
+		}
+
+		key, value, ok := strings.Cut(trimmed, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isName(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", start)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			quote := value[0]
+			body := value[1:]
+			// the closing quote may be on a later line
+			end := closingQuote(body, quote)
+			for end < 0 {
+				if src == "" {
+					return nil, fmt.Errorf("line %d: unterminated quoted value", start)
+				}
+				var next string
+				next, src, _ = strings.Cut(src, "\n")
+				line++
+				body += "\n" + next
+				end = closingQuote(body, quote)
+			}
+			if rest := strings.TrimSpace(body[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("line %d: unexpected text after closing quote", start)
+			}
+			body = body[:end]
+			if quote == '"' {
+				body = unescapeDouble(body)
+			}
+			out[key] = body
+			continue
+		}
+
+		// unquoted: a # preceded by whitespace starts a comment
+		for i := 1; i < len(value); i++ {
+			if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+				value = value[:i]
+				break
+			}
+		}
+		out[key] = strings.TrimSpace(value)
+	}
+	return out, nil
+}
+
+// index of the first unescaped quote in s, or -1
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDouble(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\', '$', '`':
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// docker --env-file: KEY=VALUE taken literally, no quotes or inline comments.
+// a bare KEY copies the variable from the current environment, like docker does
+func parseDocker(data []byte) (map[string]string, error) {
+	out := make(map[string]string)
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		line := strings.TrimLeft(raw, " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, hasValue := strings.Cut(line, "=")
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: invalid variable name '%s'", i+1, key)
+		}
+		if !hasValue {
+			if v, ok := os.LookupEnv(key); ok {
+				out[key] = v
+			}
+			continue
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+// a flat object; numbers and booleans are kept as written
+func parseJSON(data []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("expected a JSON object: %w", err)
+	}
+
+	out := make(map[string]string, len(raw))
+	for _, k := range slices.Sorted(maps.Keys(raw)) {
+		if !isName(k) {
+			return nil, fmt.Errorf("invalid variable name '%s'", k)
+		}
+		v := raw[k]
+		var s string
+		switch {
+		case json.Unmarshal(v, &s) == nil:
+		case len(v) > 0 && (v[0] == '{' || v[0] == '['):
+			return nil, fmt.Errorf("value of '%s' is not a scalar", k)
+		case string(v) == "null":
+			s = ""
+		default:
+			s = string(v)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
+
+// a flat mapping; scalars are kept as written (so 5432 and 1.10 survive)
+func parseYAML(data []byte) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string)
+	if len(doc.Content) == 0 {
+		return out, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a YAML mapping at the top level")
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		k, v := root.Content[i], root.Content[i+1]
+		if !isName(k.Value) {
+			return nil, fmt.Errorf("line %d: invalid variable name '%s'", k.Line, k.Value)
+		}
+		if v.Kind == yaml.AliasNode {
+			v = v.Alias
+		}
+		if v.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("value of '%s' is not a scalar", k.Value)
+		}
+		if v.Tag == "!!null" {
+			out[k.Value] = ""
+			continue
+		}
+		out[k.Value] = v.Value
+	}
+	return out, nil
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || i > 0 && (r >= '0' && r <= '9' || r == '.' || r == '-') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func isShellName(s string) bool {
+	return isName(s) && !strings.ContainsAny(s, ".-")
+}
+
+// bare when that's unambiguous, double quoted (with $ escaped so no dotenv
+// implementation expands it) otherwise
+func quoteDotenv(v string) string {
+	safe := v != ""
+	for _, r := range v {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("_-./:@%+,=", r)) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return v
+	}
+
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(v) + `"`
+}
+
+// single quotes are taken literally by every POSIX shell
+func quoteShell(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'"'"'`) + "'"
+}
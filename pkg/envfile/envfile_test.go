@@ -0,0 +1,78 @@
+package envfile
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	secrets := map[string]string{
+		"PLAIN":           "postgres://user@db:5432/app",
+		"EMPTY":           "",
+		"NEWLINES":        "-----BEGIN KEY-----\nabc\n-----END KEY-----\n",
+		"CRLF":            "a\r\nb",
+		"TAB":             "a\tb",
+		"DOLLAR":          "pa$$word ${HOME} $USER",
+		"DOUBLE":          `say "hi"`,
+		"SINGLE":          "it's",
+		"BACKSLASH":       `C:\path\n`,
+		"BACKTICK":        "`id`",
+		"HASH":            "#not-a-comment",
+		"SPACEHASH":       "value # not a comment either",
+		"SPACES":          "  padded  ",
+		"EQUALS":          "a=b=c",
+		"UNICODE":         "héllo ✓",
+		"NUMBER":          "007",
+		"BOOL":            "true",
+		"NULL":            "null",
+		"dotted.key-name": "x",
+	}
+
+	for _, format := range []string{"dotenv", "json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			data, err := Format(format, secrets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Parse(format, data)
+			if err != nil {
+				t.Fatalf("parsing our own output: %v\n%s", err, data)
+			}
+			if !maps.Equal(got, secrets) {
+				for k, v := range secrets {
+					if got[k] != v {
+						t.Errorf("%s: got %q, want %q", k, got[k], v)
+					}
+				}
+				t.Fatalf("round trip changed the values:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestParseRejectsInvalidNames(t *testing.T) {
+	tests := []struct {
+		format string
+		data   string
+	}{
+		{"dotenv", "MY KEY=1\n"},
+		{"json", `{"MY KEY": "1"}`},
+		{"json", `{"": "1"}`},
+		{"json", `{"1ABC": "1"}`},
+		{"yaml", "MY KEY: 1\n"},
+		{"yaml", "OK: 1\nA=B: 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.data, func(t *testing.T) {
+			_, err := Parse(tt.format, []byte(tt.data))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tt.format != "dotenv" && !strings.Contains(err.Error(), "invalid variable name") {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package injector
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// what --clean-env keeps from the surrounding environment
+var DefaultKeepEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "LANG", "LC_*", "TZ", "TMPDIR"}
+
+// applies Only/Exclude (by vault key) and then StripPrefix/Prefix (to the
+// variable name), returning variable name -> value
+func SelectSecrets(secrets map[string]string, opts Options) (map[string]string, error) {
+	for _, k := range opts.Only {
+		if _, ok := secrets[k]; !ok {
+			return nil, fmt.Errorf("--only %s: no such key", k)
+		}
+	}
+
+	out := make(map[string]string, len(secrets))
+	from := make(map[string]string, len(secrets))
+	for _, k := range selectedKeys(secrets, opts) {
+		name := opts.Prefix + strings.TrimPrefix(k, opts.StripPrefix)
+		if other, ok := from[name]; ok {
+			return nil, fmt.Errorf("%s and %s would both be injected as %s", other, k, name)
+		}
+		from[name] = k
+		out[name] = secrets[k]
+	}
+	return out, nil
+}
+
+// the vault keys Only and Exclude leave, sorted
+func selectedKeys(secrets map[string]string, opts Options) []string {
+	var keys []string
+	for _, k := range slices.Sorted(maps.Keys(secrets)) {
+		if len(opts.Only) > 0 && !slices.Contains(opts.Only, k) || slices.Contains(opts.Exclude, k) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// expands the references of what gets injected: the selected keys and the
+// ones behind Files
+func expandInjected(secrets map[string]string, opts Options) (map[string]string, error) {
+	return ExpandKeys(secrets, slices.Concat(selectedKeys(secrets, opts), slices.Sorted(maps.Values(opts.Files))))
+}
+
+// builds the command's environment with one entry per variable. secrets
+// replace variables of the same name unless NoOverride is set
+func buildEnv(parent []string, secrets map[string]string, opts Options) []string {
+	env := make([]string, 0, len(parent)+len(secrets))
+	index := make(map[string]int)
+
+	put := func(name, value string, override bool) {
+		if i, ok := index[name]; ok {
+			if override {
+				env[i] = name + "=" + value
+			}
+			return
+		}
+		index[name] = len(env)
+		env = append(env, name+"="+value)
+	}
+
+	for _, kv := range parent {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || name == "" {
+			continue
+		}
+		if opts.CleanEnv && !keepVar(name, opts.KeepEnv) {
+			continue
+		}
+		// a later duplicate wins, as it does with os/exec
+		put(name, value, true)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(secrets)) {
+		put(name, secrets[name], !opts.NoOverride)
+	}
+	return env
+}
+
+func keepVar(name string, patterns []string) bool {
+	for _, p := range slices.Concat(DefaultKeepEnv, patterns) {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package injector
+
+import "errors"
+
+func Exec(command []string, secrets map[string]string, opts Options) error {
+	return errors.New("injector: exec is not supported on this platform; use run instead")
+}
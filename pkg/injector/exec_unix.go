@@ -0,0 +1,56 @@
+//go:build unix
+
+package injector
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"syscall"
+)
+
+// replaces the current process with command instead of starting a child.
+// the command keeps our PID (PID 1 in a container) and gets signals
+// directly. only returns on failure. options that need a parent process
+// to keep running, like Redact, are refused
+func Exec(command []string, secrets map[string]string, opts Options) error {
+	if len(command) == 0 {
+		return fmt.Errorf("injector: no command provided")
+	}
+	if opts.Redact {
+		return errors.New("injector: redaction needs cloak to stay around as a parent; use run instead of exec")
+	}
+
+	secrets, err := expandInjected(secrets, opts)
+	if err != nil {
+		return fmt.Errorf("injector: %w", err)
+	}
+	injected, err := SelectSecrets(secrets, opts)
+	if err != nil {
+		return fmt.Errorf("injector: %w", err)
+	}
+
+	files, err := secretFiles(opts.Files, secrets)
+	if err != nil {
+		return err
+	}
+	defer closeAll(files)
+	for i, name := range slices.Sorted(maps.Keys(opts.Files)) {
+		// the memory file stays at the same descriptor across the exec
+		if err := keepOnExec(files[i]); err != nil {
+			return fmt.Errorf("injector: %w", err)
+		}
+		injected[name] = fmt.Sprintf("/proc/self/fd/%d", files[i].Fd())
+	}
+
+	binary, err := exec.LookPath(command[0])
+	if err != nil {
+		return fmt.Errorf("injector: failed to start command '%s': %w", command[0], err)
+	}
+
+	err = syscall.Exec(binary, command, buildEnv(os.Environ(), injected, opts))
+	return fmt.Errorf("injector: failed to exec '%s': %w", binary, err)
+}
@@ -1,61 +1,156 @@
 package injector
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
-	"os/signal"
-	"runtime"
-	"syscall"
+	"slices"
+	"time"
 )
 
-func RunCommand(command []string, secrets map[string]string) error {
+type Options struct {
+	// env var -> secret key. the secret is handed to the child as an
+	// in-memory file and the env var holds its /proc/self/fd path
+	Files map[string]string
+
+	// replace secret values in the command's output with ***KEY***
+	Redact bool
+
+	// vault keys to inject (all when empty) and to leave out
+	Only    []string
+	Exclude []string
+
+	// removed from, then added to, the name of every injected variable
+	StripPrefix string
+	Prefix      string
+
+	// start from an empty environment, keeping only DefaultKeepEnv and
+	// KeepEnv (names or patterns like LC_*)
+	CleanEnv bool
+	KeepEnv  []string
+
+	// let variables that are already set win over secrets
+	NoOverride bool
+
+	// how long the command gets to exit after being asked to stop before
+	// it is killed (DefaultGracePeriod when zero)
+	GracePeriod time.Duration
+
+	// the command's stdio, cloak's own when nil
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+}
+
+const DefaultGracePeriod = 10 * time.Second
+
+func RunCommand(command []string, secrets map[string]string, opts Options) error {
+	return RunCommandContext(context.Background(), command, secrets, opts)
+}
+
+// like RunCommand. cancelling ctx stops the command the same way a SIGTERM
+// to cloak would: the group is asked to stop and killed after the grace period
+func RunCommandContext(ctx context.Context, command []string, secrets map[string]string, opts Options) error {
 	if len(command) == 0 {
 		return fmt.Errorf("injector: no command provided")
 	}
 
+	secrets, err := expandInjected(secrets, opts)
+	if err != nil {
+		return fmt.Errorf("injector: %w", err)
+	}
+
 	binary := command[0]
 	args := command[1:]
 	cmd := exec.Command(binary, args...)
 
-	currentEnv := os.Environ()
-	secretEnv := make([]string, 0, len(secrets))
-	for k, v := range secrets {
-		secretEnv = append(secretEnv, fmt.Sprintf("%s=%s", k, v))
+	injected, err := SelectSecrets(secrets, opts)
+	if err != nil {
+		return fmt.Errorf("injector: %w", err)
+	}
+
+	// files may name any key, --only or not
+	files, err := secretFiles(opts.Files, secrets)
+	if err != nil {
+		return err
 	}
-	cmd.Env = append(currentEnv, secretEnv...)
+	defer func() { closeAll(files) }()
+	for i, name := range slices.Sorted(maps.Keys(opts.Files)) {
+		// ExtraFiles start at fd 3 in the child
+		injected[name] = fmt.Sprintf("/proc/self/fd/%d", 3+i)
+	}
+	cmd.ExtraFiles = files
+
+	cmd.Env = buildEnv(os.Environ(), injected, opts)
 
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdin = cmp.Or[io.Reader](opts.Stdin, os.Stdin)
+	cmd.Stdout = cmp.Or[io.Writer](opts.Stdout, os.Stdout)
+	cmd.Stderr = cmp.Or[io.Writer](opts.Stderr, os.Stderr)
+	// when output goes through a pipe we copy from, don't wait forever for
+	// background processes that inherited it
+	cmd.WaitDelay = relayDrainTimeout
 
-	// makes sure that child dies if parent dies (only linux)
-	if runtime.GOOS == "linux" {
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Pdeathsig: syscall.SIGKILL,
+	var out *relay
+	if opts.Redact {
+		if out, err = newRelay(cmd, secrets); err != nil {
+			return fmt.Errorf("injector: setting up redaction: %w", err)
 		}
 	}
 
+	sup := newSupervisor(cmd)
+
 	if err := cmd.Start(); err != nil {
+		sup.stop()
+		if out != nil {
+			out.closeAll()
+		}
 		return fmt.Errorf("injector: failed to start command '%s': %w", binary, err)
 	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// the child holds its own copies now; the memory goes away when it exits
+	closeAll(files)
+	files = nil
+	if out != nil {
+		out.started(cmd.Process.Pid)
+	}
 
-	// goroutine to forward signals to child
-	go func() {
-		for sig := range sigChan {
-			if cmd.Process != nil {
-				_ = cmd.Process.Signal(sig)
-			}
-		}
-	}()
+	grace := opts.GracePeriod
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+	err = sup.wait(ctx, cmd, grace)
+	if out != nil {
+		out.wait()
+	}
+	return err
+}
 
-	err := cmd.Wait()
+// one memory file per --file mapping, ordered by env var name
+func secretFiles(mapping map[string]string, secrets map[string]string) ([]*os.File, error) {
+	var files []*os.File
+	for _, name := range slices.Sorted(maps.Keys(mapping)) {
+		key := mapping[name]
+		value, ok := secrets[key]
+		if !ok {
+			closeAll(files)
+			return nil, fmt.Errorf("injector: --file %s refers to unknown key '%s'", name, key)
+		}
 
-	signal.Stop(sigChan)
-	close(sigChan)
+		f, err := memFile(key, value)
+		if err != nil {
+			closeAll(files)
+			return nil, fmt.Errorf("injector: %w", err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
 
-	return err
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
 }
@@ -0,0 +1,112 @@
+package injector
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// resolves ${KEY} references between secrets. only other secrets can be
+// referenced, never the surrounding environment. $${ stands for a literal
+// ${, and anything that isn't a well-formed ${NAME} is left as it is
+func Expand(secrets map[string]string) (map[string]string, error) {
+	return ExpandKeys(secrets, slices.Sorted(maps.Keys(secrets)))
+}
+
+// like Expand, but only resolves keys (and whatever they reference). other
+// values are passed through as stored, so a broken reference elsewhere in
+// the vault doesn't get in the way of the keys that are actually used
+func ExpandKeys(secrets map[string]string, keys []string) (map[string]string, error) {
+	e := &expander{secrets: secrets, out: make(map[string]string, len(keys)), visiting: make(map[string]bool)}
+
+	for _, k := range keys {
+		if _, ok := secrets[k]; !ok {
+			continue
+		}
+		if _, err := e.resolve(k, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	out := maps.Clone(secrets)
+	maps.Copy(out, e.out)
+	return out, nil
+}
+
+// makes value literal by writing every ${ as $${, so it is never taken
+// for a reference
+func Escape(value string) string {
+	return strings.ReplaceAll(value, "${", "$${")
+}
+
+type expander struct {
+	secrets  map[string]string
+	out      map[string]string
+	visiting map[string]bool
+}
+
+func (e *expander) resolve(key string, path []string) (string, error) {
+	if v, done := e.out[key]; done {
+		return v, nil
+	}
+	path = append(path, key)
+	if e.visiting[key] {
+		start := slices.Index(path, key)
+		return "", fmt.Errorf("reference cycle: %s", strings.Join(path[start:], " -> "))
+	}
+	e.visiting[key] = true
+	defer delete(e.visiting, key)
+
+	value := e.secrets[key]
+	var b strings.Builder
+	for i := 0; i < len(value); {
+		if strings.HasPrefix(value[i:], "$${") {
+			b.WriteString("${")
+			i += 3
+			continue
+		}
+
+		if name, n := reference(value[i:]); n > 0 {
+			if _, ok := e.secrets[name]; !ok {
+				return "", fmt.Errorf("%s references undefined key '%s' (write $${%s} for a literal)", key, name, name)
+			}
+			resolved, err := e.resolve(name, path)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(resolved)
+			i += n
+			continue
+		}
+
+		b.WriteByte(value[i])
+		i++
+	}
+
+	e.out[key] = b.String()
+	return e.out[key], nil
+}
+
+// parses a ${NAME} at the start of s, returning the name and its length
+func reference(s string) (string, int) {
+	if !strings.HasPrefix(s, "${") {
+		return "", 0
+	}
+	end := strings.IndexByte(s, '}')
+	if end < 0 {
+		return "", 0
+	}
+
+	name := s[2:end]
+	if name == "" {
+		return "", 0
+	}
+	for i, r := range name {
+		if r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || i > 0 && (r >= '0' && r <= '9' || r == '.' || r == '-') {
+			continue
+		}
+		return "", 0
+	}
+	return name, end + 1
+}
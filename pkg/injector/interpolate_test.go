@@ -0,0 +1,126 @@
+package injector
+
+import (
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/store"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets map[string]string
+		want    map[string]string
+	}{
+		{
+			"chained references",
+			map[string]string{"HOST": "db", "PORT": "5432", "ADDR": "${HOST}:${PORT}", "URL": "pg://${ADDR}/app"},
+			map[string]string{"HOST": "db", "PORT": "5432", "ADDR": "db:5432", "URL": "pg://db:5432/app"},
+		},
+		{
+			"escaped",
+			map[string]string{"A": "x", "B": "$${A} is ${A}", "C": "$$${A}"},
+			map[string]string{"A": "x", "B": "${A} is x", "C": "$${A}"},
+		},
+		{
+			"not a reference",
+			map[string]string{"A": "x", "B": "$A ${ ${} ${1A} ${A", "C": "cost: $5"},
+			map[string]string{"A": "x", "B": "$A ${ ${} ${1A} ${A", "C": "cost: $5"},
+		},
+		{
+			"escaped value is not expanded again",
+			map[string]string{"RAW": Escape("${NOT_A_KEY}"), "REF": "${RAW}"},
+			map[string]string{"RAW": "${NOT_A_KEY}", "REF": "${NOT_A_KEY}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.secrets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		secrets map[string]string
+		want    string
+	}{
+		{"self reference", map[string]string{"A": "${A}"}, "reference cycle: A -> A"},
+		{"cycle", map[string]string{"A": "${B}", "B": "${C}", "C": "${A}"}, "reference cycle: A -> B -> C -> A"},
+		{"cycle behind a valid key", map[string]string{"A": "${B}", "B": "${C}", "C": "${B}"}, "reference cycle: B -> C -> B"},
+		{"undefined", map[string]string{"A": "${MISSING}"}, "A references undefined key 'MISSING'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Expand(tt.secrets)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandKeysSkipsUnused(t *testing.T) {
+	secrets := map[string]string{"A": "${B}", "B": "b", "BROKEN": "${MISSING}"}
+
+	got, err := ExpandKeys(secrets, []string{"A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["A"] != "b" || got["BROKEN"] != "${MISSING}" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+// references resolve after inheritance, so a child environment overriding
+// a key changes every inherited value that refers to it
+func TestExpandInheritance(t *testing.T) {
+	vault := store.NewVault()
+	now := time.Now()
+	vault.Environments[store.DefaultEnv].Set("HOST", "localhost", "test", now)
+	vault.Environments[store.DefaultEnv].Set("URL", "http://${HOST}:${PORT}", "test", now)
+	vault.Environments[store.DefaultEnv].Set("PORT", "8080", "test", now)
+
+	staging, err := vault.CreateEnv("staging", store.DefaultEnv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	staging.Set("HOST", "staging.internal", "test", now)
+
+	prod, err := vault.CreateEnv("prod", "staging", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod.Set("PORT", "443", "test", now)
+
+	want := map[string]string{
+		store.DefaultEnv: "http://localhost:8080",
+		"staging":        "http://staging.internal:8080",
+		"prod":           "http://staging.internal:443",
+	}
+	for env, url := range want {
+		secrets, err := vault.Resolve(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Expand(secrets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["URL"] != url {
+			t.Errorf("%s: URL = %q, want %q", env, got["URL"], url)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package injector
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// puts content in an anonymous, sealed memory file. it never touches a
+// filesystem and is freed once every descriptor to it is closed
+func memFile(name, content string) (*os.File, error) {
+	fd, err := unix.MemfdCreate("cloak:"+name, unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return nil, fmt.Errorf("memfd_create: %w", err)
+	}
+	f := os.NewFile(uintptr(fd), name)
+
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// read-only from here on, for us and the child
+	seals := unix.F_SEAL_WRITE | unix.F_SEAL_GROW | unix.F_SEAL_SHRINK | unix.F_SEAL_SEAL
+	if _, err := unix.FcntlInt(f.Fd(), unix.F_ADD_SEALS, seals); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("sealing memfd: %w", err)
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// clears close-on-exec, so f survives an exec of this process
+func keepOnExec(f *os.File) error {
+	_, err := unix.FcntlInt(f.Fd(), unix.F_SETFD, 0)
+	return err
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package injector
+
+import (
+	"errors"
+	"os"
+)
+
+func memFile(name, content string) (*os.File, error) {
+	return nil, errors.New("secret files need memfd_create, which is only available on Linux")
+}
+
+func keepOnExec(f *os.File) error {
+	return nil
+}
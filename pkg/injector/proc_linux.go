@@ -0,0 +1,10 @@
+//go:build linux
+
+package injector
+
+import "syscall"
+
+// makes sure that child dies if parent dies
+func setParentDeathSignal(attr *syscall.SysProcAttr) {
+	attr.Pdeathsig = syscall.SIGKILL
+}
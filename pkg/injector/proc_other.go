@@ -0,0 +1,8 @@
+//go:build unix && !linux
+
+package injector
+
+import "syscall"
+
+// only linux can tie the child's life to ours
+func setParentDeathSignal(attr *syscall.SysProcAttr) {}
@@ -0,0 +1,96 @@
+//go:build linux
+
+package injector
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// opens a pty that behaves like tty: same termios and window size
+func openPty(tty *os.File) (master, slave *os.File, err error) {
+	mfd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	master = os.NewFile(uintptr(mfd), "/dev/ptmx")
+
+	if err := unix.IoctlSetPointerInt(mfd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	n, err := unix.IoctlGetUint32(mfd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	sfd, err := unix.Open(name, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	slave = os.NewFile(uintptr(sfd), name)
+
+	if t, err := unix.IoctlGetTermios(int(tty.Fd()), unix.TCGETS); err == nil {
+		// tty does the output processing already, doing it twice turns
+		// every \n into \r\r\n
+		t.Oflag &^= unix.OPOST
+		unix.IoctlSetTermios(sfd, unix.TCSETS, t)
+	}
+	resizePty(tty, master)
+	return master, slave, nil
+}
+
+// copies tty's window size to the pty. reports whether it changed
+func resizePty(tty, master *os.File) bool {
+	ws, err := unix.IoctlGetWinsize(int(tty.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return false
+	}
+	old, err := unix.IoctlGetWinsize(int(master.Fd()), unix.TIOCGWINSZ)
+	if err == nil && *old == *ws {
+		return false
+	}
+	return unix.IoctlSetWinsize(int(master.Fd()), unix.TIOCSWINSZ, ws) == nil
+}
+
+// keeps the pty the size of tty until the returned func is called. the
+// pty isn't anyone's controlling terminal, so the kernel won't tell the
+// command about a new size; we send group SIGWINCH ourselves. when the
+// command owns the terminal we don't get SIGWINCH either, hence the polling
+func followResize(tty, master *os.File, group *atomic.Int64) func() {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	tick := time.NewTicker(250 * time.Millisecond)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-winch:
+			case <-tick.C:
+			case <-done:
+				return
+			}
+			if resizePty(tty, master) {
+				if pid := group.Load(); pid > 0 {
+					syscall.Kill(-int(pid), syscall.SIGWINCH)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(winch)
+		tick.Stop()
+		close(done)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package injector
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+)
+
+// without a pty the command writes into a pipe instead
+func openPty(tty *os.File) (master, slave *os.File, err error) {
+	return nil, nil, errors.New("pty not supported on this platform")
+}
+
+func followResize(tty, master *os.File, group *atomic.Int64) func() {
+	return func() {}
+}
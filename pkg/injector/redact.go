@@ -0,0 +1,134 @@
+package injector
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"sync"
+)
+
+// shorter values would match all over the place ("1", "true", "dev")
+const minRedactLen = 4
+
+type needle struct {
+	value       []byte
+	replacement []byte
+}
+
+// Redactor replaces secret values in a byte stream with ***KEY***. a match
+// may be split across any number of writes: a tail that could still turn
+// into a secret is held back until the next write or Flush
+type Redactor struct {
+	mu      sync.Mutex
+	w       io.Writer
+	needles []needle
+	first   [256]bool
+	pending []byte
+}
+
+// catches each value as is, base64 encoded (standard and URL alphabet) and
+// URL encoded (query and path escaping)
+func NewRedactor(w io.Writer, secrets map[string]string) *Redactor {
+	r := &Redactor{w: w}
+	seen := make(map[string]bool)
+
+	// sorted so a value shared by two keys is always shown as the same one
+	for _, k := range slices.Sorted(maps.Keys(secrets)) {
+		v := secrets[k]
+		if len(v) < minRedactLen {
+			continue
+		}
+		forms := []string{
+			v,
+			// the unpadded encodings are prefixes of the padded ones
+			base64.RawStdEncoding.EncodeToString([]byte(v)),
+			base64.RawURLEncoding.EncodeToString([]byte(v)),
+			url.QueryEscape(v),
+			url.PathEscape(v),
+		}
+		for _, f := range forms {
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
+			r.needles = append(r.needles, needle{value: []byte(f), replacement: []byte("***" + k + "***")})
+			r.first[f[0]] = true
+		}
+	}
+
+	// longest first, so the longest match at a position wins
+	slices.SortStableFunc(r.needles, func(a, b needle) int { return len(b.value) - len(a.value) })
+	return r
+}
+
+// keys whose values are too short for NewRedactor to mask
+func Unredactable(secrets map[string]string) []string {
+	var keys []string
+	for k, v := range secrets {
+		if v != "" && len(v) < minRedactLen {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func (r *Redactor) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pending = append(r.pending, p...)
+	if err := r.drain(false); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writes out whatever is held back. call once the stream has ended
+func (r *Redactor) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.drain(true)
+}
+
+func (r *Redactor) drain(final bool) error {
+	var out bytes.Buffer
+	buf := r.pending
+	i, clean := 0, 0
+
+scan:
+	for i < len(buf) {
+		if !r.first[buf[i]] {
+			i++
+			continue
+		}
+		rest := buf[i:]
+		// longest first: a longer secret that could still match here has to
+		// be ruled out before a shorter one that already does is replaced
+		for _, n := range r.needles {
+			if bytes.HasPrefix(rest, n.value) {
+				out.Write(buf[clean:i])
+				out.Write(n.replacement)
+				i += len(n.value)
+				clean = i
+				continue scan
+			}
+			if !final && bytes.HasPrefix(n.value, rest) {
+				// could be the start of a secret, wait for more
+				break scan
+			}
+		}
+		i++
+	}
+	out.Write(buf[clean:i])
+	r.pending = append(r.pending[:0], buf[i:]...)
+
+	if out.Len() == 0 {
+		return nil
+	}
+	_, err := r.w.Write(out.Bytes())
+	return err
+}
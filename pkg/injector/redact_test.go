@@ -0,0 +1,69 @@
+package injector
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writes each chunk separately, then flushes
+func redact(t *testing.T, secrets map[string]string, chunks ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	r := NewRedactor(&out, secrets)
+	for _, c := range chunks {
+		if _, err := r.Write([]byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestRedactor(t *testing.T) {
+	secrets := map[string]string{
+		"TOKEN":  "s3cr3t-token",
+		"PREFIX": "s3cr3t",
+		"SPACED": "a b&c/d",
+		"SHORT":  "abc",
+	}
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"plain", []string{"token=s3cr3t-token\n"}, "token=***TOKEN***\n"},
+		{"split in two", []string{"token=s3cr", "3t-token\n"}, "token=***TOKEN***\n"},
+		{"split byte by byte", strings.Split("x s3cr3t-token y", ""), "x ***TOKEN*** y"},
+		{"longest first", []string{"s3cr3t-token s3cr3t"}, "***TOKEN*** ***PREFIX***"},
+		{"shorter value while the longer could still match", []string{"s3cr3t-to", "ken"}, "***TOKEN***"},
+		{"shorter value once the longer is ruled out", []string{"s3cr3t-to", "ast"}, "***PREFIX***-toast"},
+		{"held back until flush", []string{"ends with s3cr3t-t"}, "ends with ***PREFIX***-t"},
+		{"base64", []string{base64.StdEncoding.EncodeToString([]byte("s3cr3t-token"))}, "***TOKEN***"},
+		{"base64 url, padding kept", []string{base64.URLEncoding.EncodeToString([]byte("a b&c/d"))}, "***SPACED***=="},
+		{"query escaped", []string{"?q=" + url.QueryEscape("a b&c/d")}, "?q=***SPACED***"},
+		{"path escaped", []string{"/" + url.PathEscape("a b&c/d")}, "/***SPACED***"},
+		{"too short", []string{"abc"}, "abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact(t, secrets, tt.chunks...); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnredactable(t *testing.T) {
+	got := Unredactable(map[string]string{"A": "abc", "B": "abcd", "C": "", "D": "1"})
+	if want := []string{"A", "D"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package injector
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// how long to keep reading after the command exited, in case something it
+// started in the background still holds its output open
+const relayDrainTimeout = 2 * time.Second
+
+// relay runs the command's stdout and stderr through redactors on their
+// way out. stdout and stderr that end up in the same place share one pipe,
+// so the command's interleaving survives; a terminal gets a pty, so the
+// command still sees a terminal (colors, line buffering, window size)
+type relay struct {
+	childEnds []*os.File
+	done      sync.WaitGroup
+	redactors []*Redactor
+	stop      []func()
+	// the command's process group, once it runs
+	group atomic.Int64
+}
+
+// takes over cmd.Stdout and cmd.Stderr
+func newRelay(cmd *exec.Cmd, secrets map[string]string) (*relay, error) {
+	r := &relay{}
+
+	if sameTarget(cmd.Stdout, cmd.Stderr) {
+		w, err := r.add(cmd.Stdout, secrets)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdout, cmd.Stderr = w, w
+		return r, nil
+	}
+
+	w, err := r.add(cmd.Stdout, secrets)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Stderr, err = r.add(cmd.Stderr, secrets); err != nil {
+		r.closeAll()
+		return nil, err
+	}
+	cmd.Stdout = w
+	return r, nil
+}
+
+// sets up one redacted stream to dst and returns the end for the command
+func (r *relay) add(dst io.Writer, secrets map[string]string) (*os.File, error) {
+	var src, child *os.File
+
+	if tty, ok := dst.(*os.File); ok && term.IsTerminal(tty.Fd()) {
+		master, slave, err := openPty(tty)
+		if err == nil {
+			src, child = master, slave
+			r.stop = append(r.stop, followResize(tty, master, &r.group))
+		}
+	}
+	if src == nil {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		src, child = pr, pw
+	}
+	r.childEnds = append(r.childEnds, child)
+
+	red := NewRedactor(dst, secrets)
+	r.redactors = append(r.redactors, red)
+
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		defer src.Close()
+		// a pty reports EIO rather than EOF once the command is gone;
+		// either way there's nothing more to read
+		io.Copy(red, src)
+	}()
+	return child, nil
+}
+
+// the command holds its own copies once it started. ours have to go, or
+// the readers would never see EOF
+func (r *relay) started(pid int) {
+	r.group.Store(int64(pid))
+	for _, f := range r.childEnds {
+		f.Close()
+	}
+	r.childEnds = nil
+}
+
+// waits for the output to drain after the command exited and writes out
+// anything still held back
+func (r *relay) wait() {
+	finished := make(chan struct{})
+	go func() {
+		r.done.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(relayDrainTimeout):
+	}
+
+	for _, stop := range r.stop {
+		stop()
+	}
+	for _, red := range r.redactors {
+		red.Flush()
+	}
+}
+
+// used when the command couldn't be started
+func (r *relay) closeAll() {
+	r.started(0)
+	r.wait()
+}
+
+func sameTarget(a, b io.Writer) bool {
+	if a == b {
+		return true
+	}
+	af, ok := a.(*os.File)
+	if !ok {
+		return false
+	}
+	bf, ok := b.(*os.File)
+	if !ok {
+		return false
+	}
+
+	ai, err := af.Stat()
+	if err != nil {
+		return false
+	}
+	bi, err := bf.Stat()
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
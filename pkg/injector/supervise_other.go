@@ -0,0 +1,44 @@
+//go:build !unix
+
+package injector
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+// without process groups and POSIX signals there is little to relay: the
+// console delivers Ctrl-C to the command itself. we only have to survive
+// it ourselves so the exit status still comes through
+type supervisor struct {
+	sigs chan os.Signal
+}
+
+func newSupervisor(cmd *exec.Cmd) *supervisor {
+	s := &supervisor{sigs: make(chan os.Signal, 1)}
+	signal.Notify(s.sigs, os.Interrupt)
+	return s
+}
+
+func (s *supervisor) wait(ctx context.Context, cmd *exec.Cmd, grace time.Duration) error {
+	defer s.stop()
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err := <-exited:
+		return err
+	case <-ctx.Done():
+		// no way to ask nicely
+		cmd.Process.Kill()
+		return <-exited
+	}
+}
+
+func (s *supervisor) stop() {
+	signal.Stop(s.sigs)
+}
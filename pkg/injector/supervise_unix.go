@@ -0,0 +1,135 @@
+//go:build unix
+
+package injector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/sys/unix"
+)
+
+// everything we pass on to the command's process group
+var relayedSignals = []os.Signal{
+	syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH,
+}
+
+// the ones that ask the command to stop, and start the grace period
+func stopsCommand(sig os.Signal) bool {
+	switch sig {
+	case syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT:
+		return true
+	}
+	return false
+}
+
+// supervisor runs the command in a process group of its own, so signals
+// reach everything it started (npm -> node -> esbuild) and not just the
+// direct child
+type supervisor struct {
+	sigs chan os.Signal
+	// the command's group owns the terminal while it runs
+	foreground bool
+	tty        *os.File
+}
+
+// prepares cmd before Start. signals are caught from here on, so none
+// slip through between starting the command and relaying to it
+func newSupervisor(cmd *exec.Cmd) *supervisor {
+	s := &supervisor{sigs: make(chan os.Signal, 8)}
+
+	// when we own the terminal, the command has to own it instead: a
+	// background group that reads from it would be stopped with SIGTTIN.
+	// Ctrl-C then goes to the command directly
+	if tty, ok := cmd.Stdin.(*os.File); ok && term.IsTerminal(tty.Fd()) {
+		pgrp, err := unix.IoctlGetInt(int(tty.Fd()), unix.TIOCGPGRP)
+		s.foreground = err == nil && pgrp == syscall.Getpgrp()
+		s.tty = tty
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Foreground: s.foreground,
+		Ctty:       0, // the command's stdin
+	}
+	setParentDeathSignal(cmd.SysProcAttr)
+
+	signal.Notify(s.sigs, relayedSignals...)
+	return s
+}
+
+// relays signals to the command's group until the command exits. after a
+// stop signal (or ctx being done) the group gets grace to exit before it is
+// killed
+func (s *supervisor) wait(ctx context.Context, cmd *exec.Cmd, grace time.Duration) error {
+	defer s.stop()
+
+	group := -cmd.Process.Pid
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var deadline <-chan time.Time
+	cancelled := ctx.Done()
+	for {
+		select {
+		case <-cancelled:
+			cancelled = nil
+			syscall.Kill(group, syscall.SIGTERM)
+			if deadline == nil {
+				deadline = time.After(grace)
+			}
+		case sig := <-s.sigs:
+			syscall.Kill(group, sig.(syscall.Signal))
+			if stopsCommand(sig) && deadline == nil {
+				deadline = time.After(grace)
+			}
+		case <-deadline:
+			syscall.Kill(group, syscall.SIGKILL)
+		case err := <-exited:
+			if deadline != nil {
+				// the rest of the group is shutting down too; give it
+				// what is left of the grace period
+				reapGroup(group, deadline)
+			}
+			return err
+		}
+	}
+}
+
+// waits until nothing is left in group, killing it once deadline passes
+func reapGroup(group int, deadline <-chan time.Time) {
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+
+	for {
+		if err := syscall.Kill(group, 0); errors.Is(err, syscall.ESRCH) {
+			return
+		}
+		select {
+		case <-tick.C:
+		case <-deadline:
+			syscall.Kill(group, syscall.SIGKILL)
+			return
+		}
+	}
+}
+
+// undoes newSupervisor, also when the command couldn't be started
+func (s *supervisor) stop() {
+	signal.Stop(s.sigs)
+
+	if s.foreground {
+		// take the terminal back. we're a background group at this point,
+		// which would get SIGTTOU for trying
+		signal.Ignore(syscall.SIGTTOU)
+		unix.IoctlSetPointerInt(int(s.tty.Fd()), unix.TIOCSPGRP, syscall.Getpgrp())
+		signal.Reset(syscall.SIGTTOU)
+	}
+}
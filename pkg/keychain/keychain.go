@@ -16,6 +16,9 @@ const (
 	Service      = "cloak-cli"
 	FallbackDir  = ".cloak"
 	FallbackFile = "keystore.json"
+
+	// keychain entry holding the user's X25519 identity (not project scoped)
+	IdentityUser = "identity"
 )
 
 func GenerateScopeID(path string) (string, error) {
@@ -66,6 +69,52 @@ func Delete(scopePath string) error {
 	return nil
 }
 
+// environments sealed with their own key store it under the project
+// scope plus the environment name
+func SaveEnvKey(scopePath, env, key string) error {
+	user, err := GenerateScopeID(scopePath)
+	if err != nil {
+		return err
+	}
+	user += ":" + env
+
+	if err := keyring.Set(Service, user, key); err == nil {
+		return nil
+	}
+
+	return saveToLocalStore(user, key)
+}
+
+func GetEnvKey(scopePath, env string) (string, error) {
+	user, err := GenerateScopeID(scopePath)
+	if err != nil {
+		return "", err
+	}
+	user += ":" + env
+
+	if key, err := keyring.Get(Service, user); err == nil {
+		return key, nil
+	}
+
+	return getFromLocalStore(user)
+}
+
+func SaveIdentity(identity string) error {
+	if err := keyring.Set(Service, IdentityUser, identity); err == nil {
+		return nil
+	}
+
+	return saveToLocalStore(IdentityUser, identity)
+}
+
+func GetIdentity() (string, error) {
+	if identity, err := keyring.Get(Service, IdentityUser); err == nil {
+		return identity, nil
+	}
+
+	return getFromLocalStore(IdentityUser)
+}
+
 var storeMutex sync.Mutex
 
 func getStorePath() (string, error) {
@@ -0,0 +1,249 @@
+package sharing
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDropNotFound = errors.New("drop not found")
+	ErrStoreFull    = errors.New("drop store is full")
+)
+
+// caps on what a store holds at once; zero means no limit. expired drops
+// count until they are swept
+type DropLimits struct {
+	MaxDrops int
+	MaxBytes int64
+}
+
+func (l DropLimits) allows(drops int, bytes int64, blob []byte) bool {
+	if l.MaxDrops > 0 && drops+1 > l.MaxDrops {
+		return false
+	}
+	if l.MaxBytes > 0 && bytes+int64(len(blob)) > l.MaxBytes {
+		return false
+	}
+	return true
+}
+
+// storage behind a drop server. Take must hand a drop out at most once,
+// even under concurrent claims
+type DropStore interface {
+	Put(id string, blob []byte, expires time.Time) error
+	Take(id string, now time.Time) ([]byte, error)
+	// removes drops that expired before now
+	Sweep(now time.Time) error
+}
+
+type memoryDrop struct {
+	blob    []byte
+	expires time.Time
+}
+
+// keeps drops in memory; everything is gone when the server restarts
+type MemoryStore struct {
+	Limits DropLimits
+
+	mu    sync.Mutex
+	drops map[string]memoryDrop
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{drops: make(map[string]memoryDrop)}
+}
+
+func (m *MemoryStore) Put(id string, blob []byte, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var total int64
+	for _, d := range m.drops {
+		total += int64(len(d.blob))
+	}
+	if !m.Limits.allows(len(m.drops), total, blob) {
+		return ErrStoreFull
+	}
+
+	m.drops[id] = memoryDrop{blob: blob, expires: expires}
+	return nil
+}
+
+func (m *MemoryStore) Take(id string, now time.Time) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.drops[id]
+	if !ok {
+		return nil, ErrDropNotFound
+	}
+	delete(m.drops, id)
+
+	if now.After(d.expires) {
+		return nil, ErrDropNotFound
+	}
+	return d.blob, nil
+}
+
+func (m *MemoryStore) Sweep(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, d := range m.drops {
+		if now.After(d.expires) {
+			delete(m.drops, id)
+		}
+	}
+	return nil
+}
+
+// keeps one file per drop in Dir: an 8-byte expiry (unix seconds, big
+// endian) followed by the blob
+type DiskStore struct {
+	Dir    string
+	Limits DropLimits
+
+	// serializes the limit check with the write that follows it
+	mu sync.Mutex
+}
+
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskStore{Dir: dir}, nil
+}
+
+const dropSuffix = ".drop"
+
+func (d *DiskStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", ErrDropNotFound
+	}
+	return filepath.Join(d.Dir, id+dropSuffix), nil
+}
+
+func (d *DiskStore) Put(id string, blob []byte, expires time.Time) error {
+	path, err := d.path(id)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.Limits != (DropLimits{}) {
+		drops, total, err := d.usage()
+		if err != nil {
+			return err
+		}
+		if !d.Limits.allows(drops, total, blob) {
+			return ErrStoreFull
+		}
+	}
+
+	data := binary.BigEndian.AppendUint64(nil, uint64(expires.Unix()))
+	data = append(data, blob...)
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *DiskStore) Take(id string, now time.Time) ([]byte, error) {
+	path, err := d.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// renaming is atomic, so only one concurrent claim gets the file
+	claimed := fmt.Sprintf("%s.claimed-%d", path, now.UnixNano())
+	if err := os.Rename(path, claimed); err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrDropNotFound
+		}
+		return nil, err
+	}
+	defer os.Remove(claimed)
+
+	data, err := os.ReadFile(claimed)
+	if err != nil {
+		return nil, err
+	}
+	expires, blob, err := decodeDrop(data)
+	if err != nil {
+		return nil, err
+	}
+	if now.After(expires) {
+		return nil, ErrDropNotFound
+	}
+	return blob, nil
+}
+
+func (d *DiskStore) Sweep(now time.Time) error {
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		path := filepath.Join(d.Dir, e.Name())
+		if !strings.HasSuffix(e.Name(), dropSuffix) {
+			// leftovers from an interrupted write or claim
+			if strings.Contains(e.Name(), dropSuffix+".") {
+				if info, err := e.Info(); err == nil && now.Sub(info.ModTime()) > time.Hour {
+					os.Remove(path)
+				}
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if expires, _, err := decodeDrop(data); err != nil || now.After(expires) {
+			os.Remove(path)
+		}
+	}
+	return nil
+}
+
+// number of stored drops and the size of their blobs
+func (d *DiskStore) usage() (int, int64, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var drops int
+	var total int64
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), dropSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		drops++
+		total += max(info.Size()-8, 0)
+	}
+	return drops, total, nil
+}
+
+func decodeDrop(data []byte) (time.Time, []byte, error) {
+	if len(data) < 8 {
+		return time.Time{}, nil, fmt.Errorf("corrupt drop file")
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(data[:8])), 0)
+	return expires, data[8:], nil
+}
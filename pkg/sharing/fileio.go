@@ -0,0 +1,97 @@
+package sharing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const FileIOEndpoint = "https://file.io"
+
+type FileIOResponse struct {
+	Success bool   `json:"success"`
+	Key     string `json:"key"`
+	Link    string `json:"link"`
+	Message string `json:"message,omitempty"`
+}
+
+// file.io compatible upload service. files are deleted after the first download
+type FileIO struct {
+	// defaults to FileIOEndpoint
+	Endpoint string
+}
+
+func (f *FileIO) endpoint() string {
+	if f.Endpoint == "" {
+		return FileIOEndpoint
+	}
+	return strings.TrimRight(f.Endpoint, "/")
+}
+
+func (f *FileIO) Put(ctx context.Context, blob []byte, ttl time.Duration) (string, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile("file", "secret.bin")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, bytes.NewReader(blob)); err != nil {
+		return "", err
+	}
+
+	_ = writer.WriteField("expires", fileIOExpiry(ttl))
+
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", f.endpoint(), body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server returned status: %d", resp.StatusCode)
+	}
+
+	var result FileIOResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if !result.Success {
+		return "", fmt.Errorf("api error: %s", result.Message)
+	}
+
+	if result.Link != "" {
+		return result.Link, nil
+	}
+	return f.endpoint() + "/" + result.Key, nil
+}
+
+// file.io takes expiries like "1d" or "3h"; round up to whole hours
+func fileIOExpiry(ttl time.Duration) string {
+	hours := int((ttl + time.Hour - 1) / time.Hour)
+	if hours < 1 {
+		hours = 1
+	}
+	if hours%24 == 0 {
+		return fmt.Sprintf("%dd", hours/24)
+	}
+	return fmt.Sprintf("%dh", hours)
+}
@@ -0,0 +1,164 @@
+package sharing
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// presigned URLs can't outlive this (SigV4 limit)
+const s3MaxExpiry = 7 * 24 * time.Hour
+
+// any S3-compatible bucket (AWS, R2, MinIO, ...). The blob is uploaded with
+// a presigned PUT and shared as a presigned GET that expires after the TTL.
+// S3 can't delete on first read, so add a lifecycle rule to the bucket
+// (or prefix) that expires old objects
+type S3 struct {
+	// e.g. https://s3.eu-west-1.amazonaws.com or https://<account>.r2.cloudflarestorage.com
+	Endpoint     string
+	Region       string
+	Bucket       string
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+func (s *S3) Put(ctx context.Context, blob []byte, ttl time.Duration) (string, error) {
+	if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+		return "", fmt.Errorf("s3 backend needs an endpoint, bucket and credentials")
+	}
+	if ttl > s3MaxExpiry {
+		return "", fmt.Errorf("s3 links can't be valid for longer than %s", s3MaxExpiry)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	object := s.Prefix + hex.EncodeToString(id)
+
+	now := time.Now().UTC()
+	putURL, err := s.presign(http.MethodPut, object, 15*time.Minute, now)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, putURL, bytes.NewReader(blob))
+	if err != nil {
+		return "", err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("server returned status: %d", resp.StatusCode)
+	}
+
+	return s.presign(http.MethodGet, object, ttl, now)
+}
+
+// builds a SigV4 query-string presigned URL (path-style addressing)
+func (s *S3) presign(method, object string, expires time.Duration, now time.Time) (string, error) {
+	endpoint, err := url.Parse(strings.TrimRight(s.Endpoint, "/"))
+	if err != nil {
+		return "", fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	scope := date + "/" + region + "/s3/aws4_request"
+	path := endpoint.Path + "/" + awsEscape(s.Bucket, false) + "/" + awsEscape(object, false)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    s.AccessKey + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       fmt.Sprint(int(expires.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	if s.SessionToken != "" {
+		query["X-Amz-Security-Token"] = s.SessionToken
+	}
+
+	names := make([]string, 0, len(query))
+	for k := range query {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, k := range names {
+		pairs[i] = awsEscape(k, true) + "=" + awsEscape(query[k], true)
+	}
+	canonicalQuery := strings.Join(pairs, "&")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		canonicalQuery,
+		"host:" + endpoint.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	signingKey := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return endpoint.Scheme + "://" + endpoint.Host + path + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// URI encoding as SigV4 defines it: everything but unreserved characters,
+// with '/' kept in paths
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package sharing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type DropServerOptions struct {
+	// largest blob accepted, in bytes
+	MaxSize int64
+	// upper bound (and default) for a drop's lifetime
+	MaxTTL time.Duration
+	// base URL put into returned links; defaults to the request's host
+	PublicURL string
+}
+
+// file.io compatible dead drop server: POST / with a multipart "file" (and an
+// optional "expires" such as "1h" or "2d") stores it, GET /<key> hands it out
+// once and deletes it
+type DropServer struct {
+	Store DropStore
+	Opts  DropServerOptions
+
+	now func() time.Time
+}
+
+func NewDropServer(store DropStore, opts DropServerOptions) *DropServer {
+	return &DropServer{Store: store, Opts: opts, now: time.Now}
+}
+
+func (s *DropServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{$}", s.handleUpload)
+	mux.HandleFunc("GET /{id}", s.handleClaim)
+	return mux
+}
+
+func (s *DropServer) handleUpload(w http.ResponseWriter, r *http.Request) {
+	// leave room for the multipart framing around the blob
+	r.Body = http.MaxBytesReader(w, r.Body, s.Opts.MaxSize+4096)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeDropError(w, http.StatusRequestEntityTooLarge, "file too large")
+			return
+		}
+		writeDropError(w, http.StatusBadRequest, "missing file")
+		return
+	}
+	defer file.Close()
+
+	blob, err := io.ReadAll(io.LimitReader(file, s.Opts.MaxSize+1))
+	if err != nil {
+		writeDropError(w, http.StatusBadRequest, "failed to read file")
+		return
+	}
+	if int64(len(blob)) > s.Opts.MaxSize {
+		writeDropError(w, http.StatusRequestEntityTooLarge, "file too large")
+		return
+	}
+
+	ttl := s.Opts.MaxTTL
+	if v := r.FormValue("expires"); v != "" {
+		requested, err := parseExpiry(v)
+		if err != nil {
+			writeDropError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ttl = min(requested, s.Opts.MaxTTL)
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		writeDropError(w, http.StatusInternalServerError, "failed to generate key")
+		return
+	}
+	id := hex.EncodeToString(raw)
+
+	expires := s.now().Add(ttl)
+	err = s.Store.Put(id, blob, expires)
+	if errors.Is(err, ErrStoreFull) {
+		// expired drops still count against the limits until they're swept
+		if err = s.Store.Sweep(s.now()); err == nil {
+			err = s.Store.Put(id, blob, expires)
+		}
+	}
+	if errors.Is(err, ErrStoreFull) {
+		writeDropError(w, http.StatusInsufficientStorage, "server is full, try again later")
+		return
+	} else if err != nil {
+		log.Printf("drop-server: store: %v", err)
+		writeDropError(w, http.StatusInternalServerError, "failed to store file")
+		return
+	}
+
+	writeDropJSON(w, http.StatusOK, FileIOResponse{Success: true, Key: id, Link: s.baseURL(r) + "/" + id})
+}
+
+func (s *DropServer) handleClaim(w http.ResponseWriter, r *http.Request) {
+	blob, err := s.Store.Take(r.PathValue("id"), s.now())
+	if errors.Is(err, ErrDropNotFound) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Printf("drop-server: claim: %v", err)
+		http.Error(w, "failed to read drop", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(blob)
+}
+
+func (s *DropServer) baseURL(r *http.Request) string {
+	if s.Opts.PublicURL != "" {
+		return strings.TrimRight(s.Opts.PublicURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// "30m", "3h", "2d", "1w" -> duration
+func parseExpiry(v string) (time.Duration, error) {
+	units := map[byte]time.Duration{'m': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+
+	if len(v) >= 2 {
+		if unit, ok := units[v[len(v)-1]]; ok {
+			if n, err := strconv.Atoi(v[:len(v)-1]); err == nil && n > 0 {
+				return time.Duration(n) * unit, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid expires '%s'", v)
+}
+
+func writeDropError(w http.ResponseWriter, status int, msg string) {
+	writeDropJSON(w, status, FileIOResponse{Message: msg})
+}
+
+func writeDropJSON(w http.ResponseWriter, status int, resp FileIOResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,187 @@
+package sharing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a drop server on a local listener with a clock the test controls
+func newTestServer(t *testing.T, store DropStore, opts DropServerOptions) (*httptest.Server, func(time.Duration)) {
+	t.Helper()
+
+	var mu sync.Mutex
+	now := time.Now()
+	s := NewDropServer(store, opts)
+	s.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	return ts, advance
+}
+
+func testStores(t *testing.T) map[string]DropStore {
+	disk, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]DropStore{"memory": NewMemoryStore(), "disk": disk}
+}
+
+func TestDropServerSingleRead(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ts, _ := newTestServer(t, store, DropServerOptions{MaxSize: 1 << 10, MaxTTL: time.Hour})
+			ctx := context.Background()
+
+			key := []byte(strings.Repeat("ab", 32))
+			link, err := CreateDeadDrop(ctx, &FileIO{Endpoint: ts.URL}, key, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := ClaimDeadDrop(ctx, link)
+			if err != nil {
+				t.Fatalf("first claim: %v", err)
+			}
+			if !bytes.Equal(got, key) {
+				t.Fatalf("claimed %q, want %q", got, key)
+			}
+
+			if _, err := ClaimDeadDrop(ctx, link); err == nil {
+				t.Fatal("second claim of the same drop succeeded")
+			}
+		})
+	}
+}
+
+func TestDropServerExpiry(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ts, advance := newTestServer(t, store, DropServerOptions{MaxSize: 1 << 10, MaxTTL: 2 * time.Hour})
+			ctx := context.Background()
+			backend := &FileIO{Endpoint: ts.URL}
+
+			// file.io expiries are whole hours
+			short, err := CreateDeadDrop(ctx, backend, []byte("short"), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// more than MaxTTL, so capped at two hours
+			long, err := CreateDeadDrop(ctx, backend, []byte("long"), 48*time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fresh, err := CreateDeadDrop(ctx, backend, []byte("fresh"), 2*time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			advance(61 * time.Minute)
+			if _, err := ClaimDeadDrop(ctx, short); err == nil {
+				t.Fatal("claimed a drop after its TTL")
+			}
+			if _, err := ClaimDeadDrop(ctx, fresh); err != nil {
+				t.Fatalf("drop within its TTL: %v", err)
+			}
+
+			advance(time.Hour)
+			if _, err := ClaimDeadDrop(ctx, long); err == nil {
+				t.Fatal("claimed a drop after the server's MaxTTL")
+			}
+		})
+	}
+}
+
+func TestDropServerSizeCap(t *testing.T) {
+	ts, _ := newTestServer(t, NewMemoryStore(), DropServerOptions{MaxSize: 64, MaxTTL: time.Hour})
+	ctx := context.Background()
+	backend := &FileIO{Endpoint: ts.URL}
+
+	if _, err := backend.Put(ctx, make([]byte, 64), time.Hour); err != nil {
+		t.Fatalf("blob at the limit rejected: %v", err)
+	}
+
+	_, err := backend.Put(ctx, make([]byte, 65), time.Hour)
+	if err == nil || !strings.Contains(err.Error(), "413") {
+		t.Fatalf("blob over the limit: got %v, want status %d", err, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestDropServerStoreLimits(t *testing.T) {
+	limits := map[string]DropLimits{
+		"drops": {MaxDrops: 2},
+		// dead drops of a 16-byte secret are under 50 bytes each
+		"bytes": {MaxBytes: 100},
+	}
+
+	for limit, l := range limits {
+		for name, store := range testStores(t) {
+			switch s := store.(type) {
+			case *MemoryStore:
+				s.Limits = l
+			case *DiskStore:
+				s.Limits = l
+			}
+
+			t.Run(limit+"/"+name, func(t *testing.T) {
+				ts, advance := newTestServer(t, store, DropServerOptions{MaxSize: 64, MaxTTL: time.Hour})
+				ctx := context.Background()
+				backend := &FileIO{Endpoint: ts.URL}
+
+				first, err := CreateDeadDrop(ctx, backend, make([]byte, 16), time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := CreateDeadDrop(ctx, backend, make([]byte, 16), time.Hour); err != nil {
+					t.Fatal(err)
+				}
+
+				_, err = CreateDeadDrop(ctx, backend, make([]byte, 16), time.Hour)
+				if err == nil || !strings.Contains(err.Error(), "507") {
+					t.Fatalf("upload over the limit: got %v, want status %d", err, http.StatusInsufficientStorage)
+				}
+
+				// a claimed drop frees its slot
+				if _, err := ClaimDeadDrop(ctx, first); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := CreateDeadDrop(ctx, backend, make([]byte, 16), time.Hour); err != nil {
+					t.Fatalf("upload after a claim: %v", err)
+				}
+
+				// and so do expired ones, once swept
+				advance(2 * time.Hour)
+				if _, err := CreateDeadDrop(ctx, backend, make([]byte, 16), time.Hour); err != nil {
+					t.Fatalf("upload after the others expired: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestFileIOUsesReturnedLink(t *testing.T) {
+	ts, _ := newTestServer(t, NewMemoryStore(), DropServerOptions{MaxSize: 64, MaxTTL: time.Hour, PublicURL: "https://drops.example.com"})
+
+	link, err := (&FileIO{Endpoint: ts.URL}).Put(context.Background(), []byte("x"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, "https://drops.example.com/") {
+		t.Fatalf("link = %q, want the server's public URL", link)
+	}
+}
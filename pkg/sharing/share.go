@@ -1,28 +1,30 @@
 package sharing
 
 import (
-	"bytes"
+	"context"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/atomisadev/cloak/pkg/crypto"
 )
 
-const FileIOEndpoint = "https://file.io"
+// maximum size of a blob fetched by ClaimDeadDrop
+const maxBlobSize = 1 << 20
 
-type FileIOResponse struct {
-	Success bool   `json:"success"`
-	Key     string `json:"key"`
-	Link    string `json:"link"`
-	Message string `json:"message,omitempty"`
+// somewhere to park an encrypted blob for a short while.
+// Put returns a URL that serves the blob back to a plain GET request
+type DropBackend interface {
+	Put(ctx context.Context, blob []byte, ttl time.Duration) (string, error)
 }
 
-func CreateDeadDrop(masterKey []byte) (string, error) {
+// encrypts the master key with a one-off fragment key, uploads the
+// ciphertext and returns a link of the form <blob url>#<fragment key>.
+// the fragment never leaves the client, so the backend only sees ciphertext
+func CreateDeadDrop(ctx context.Context, backend DropBackend, masterKey []byte, ttl time.Duration) (string, error) {
 	fragmentKeyHex, err := crypto.GenerateKey()
 	if err != nil {
 		return "", fmt.Errorf("failed to generate fragment key: %w", err)
@@ -34,59 +36,55 @@ func CreateDeadDrop(masterKey []byte) (string, error) {
 		return "", fmt.Errorf("failed to encrypt master key: %w", err)
 	}
 
-	fileKey, err := uploadToEphemeralStore(encryptedBlob)
+	blobURL, err := backend.Put(ctx, encryptedBlob, ttl)
 	if err != nil {
 		return "", fmt.Errorf("upload failed: %w", err)
 	}
 
-	magicLink := fmt.Sprintf("https://cloak.hitmo.xyz/claim/%s#%s", fileKey, fragmentKeyHex)
-
-	return magicLink, nil
+	return blobURL + "#" + fragmentKeyHex, nil
 }
 
-func uploadToEphemeralStore(data []byte) (string, error) {
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	part, err := writer.CreateFormFile("file", "secret.bin")
+// fetches the blob behind a dead drop link and decrypts it with the key
+// in the URL fragment
+func ClaimDeadDrop(ctx context.Context, link string) ([]byte, error) {
+	u, err := url.Parse(link)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("invalid link: %w", err)
 	}
-	if _, err := io.Copy(part, bytes.NewReader(data)); err != nil {
-		return "", err
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("invalid link: unsupported scheme '%s'", u.Scheme)
 	}
 
-	_ = writer.WriteField("expires", "1d")
-
-	if err := writer.Close(); err != nil {
-		return "", err
+	fragmentKey, err := hex.DecodeString(u.Fragment)
+	if err != nil || len(fragmentKey) != 32 {
+		return nil, fmt.Errorf("invalid link: missing or malformed key fragment")
 	}
+	u.Fragment = ""
 
-	req, err := http.NewRequest("POST", FileIOEndpoint, body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("server returned status: %d", resp.StatusCode)
+		return nil, fmt.Errorf("server returned status: %d (the drop may have been claimed already or expired)", resp.StatusCode)
 	}
 
-	var result FileIOResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+	blob, err := io.ReadAll(io.LimitReader(resp.Body, maxBlobSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download drop: %w", err)
 	}
 
-	if !result.Success {
-		return "", fmt.Errorf("api error: %s", result.Message)
+	masterKey, err := crypto.Decrypt(blob, fragmentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt drop: %w", err)
 	}
-
-	return result.Key, nil
+	return masterKey, nil
 }
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package store
+
+import "os"
+
+// no flock here, so fall back to a lock file created exclusively next to
+// the vault. a crashed process leaves it behind and it has to be removed by hand
+func tryLock(path string) (func() error, error) {
+	lockPath := path + ".lock"
+
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if os.IsExist(err) {
+		return nil, ErrLocked
+	} else if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	return func() error { return os.Remove(lockPath) }, nil
+}
+
+// directories can't be fsynced here; the rename is as durable as the OS makes it
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+)
+
+// on-disk layout of cloak.encrypted:
+//
+//	[ magic "CLOAK" | version (1) | header length (2, big endian) | header (JSON) | nonce | ciphertext + tag ]
+//
+// everything before the nonce is fed to GCM as associated data, so the
+// header can't be tampered with without breaking decryption.
+// files without the magic prefix are legacy [nonce | ciphertext] blobs.
+//
+// v1 stored a flat key/value map, v2 stores a Vault with named environments,
+// v3 adds per-secret metadata (also inside sealed environments)
+const (
+	Magic         = "CLOAK"
+	FormatVersion = 3
+
+	AlgAES256GCM = "aes-256-gcm"
+)
+
+var ErrLegacyFormat = errors.New("vault uses the legacy headerless format")
+
+type Header struct {
+	Version   uint8  `json:"-"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+
+	// set when the vault key is derived from a passphrase
+	KDF *crypto.KDFParams `json:"kdf,omitempty"`
+
+	// the vault key wrapped for individual users (see recipients.go)
+	Recipients []Recipient `json:"recipients,omitempty"`
+
+	// retired keys that still unlock the vault for a while (see grace.go)
+	Grace []GraceKey `json:"grace,omitempty"`
+}
+
+// fills in the fields that are determined by the key itself
+func (h *Header) bind(key []byte) {
+	h.Version = FormatVersion
+	h.Algorithm = AlgAES256GCM
+	h.KeyID = crypto.KeyID(key)
+}
+
+// header for a save with the given key. settings of the vault already at
+// path (e.g. the KDF parameters) are carried over as long as the key is unchanged
+func headerFor(path string, key []byte) *Header {
+	h := &Header{}
+	h.bind(key)
+
+	if prev, err := ReadHeader(path); err == nil && prev.KeyID == h.KeyID {
+		h.KDF = prev.KDF
+		h.Recipients = prev.Recipients
+		h.Grace = activeGraceKeys(prev.Grace)
+	}
+	return h
+}
+
+func isLegacy(data []byte) bool {
+	return !bytes.HasPrefix(data, []byte(Magic))
+}
+
+func encodeHeader(h *Header) ([]byte, error) {
+	hdrJSON, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	if len(hdrJSON) > math.MaxUint16 {
+		return nil, errors.New("vault header too large")
+	}
+
+	out := make([]byte, 0, len(Magic)+3+len(hdrJSON))
+	out = append(out, Magic...)
+	out = append(out, h.Version)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(hdrJSON)))
+	out = append(out, hdrJSON...)
+	return out, nil
+}
+
+// splits a framed vault into its header, the raw header bytes (used as
+// associated data) and the encrypted body
+func decodeHeader(data []byte) (*Header, []byte, []byte, error) {
+	prefixLen := len(Magic) + 3
+	if len(data) < prefixLen {
+		return nil, nil, nil, errors.New("vault header truncated")
+	}
+
+	version := data[len(Magic)]
+	if version > FormatVersion {
+		return nil, nil, nil, fmt.Errorf("vault format v%d is newer than this version of cloak supports (v%d)", version, FormatVersion)
+	}
+
+	hdrLen := int(binary.BigEndian.Uint16(data[len(Magic)+1 : prefixLen]))
+	if len(data) < prefixLen+hdrLen {
+		return nil, nil, nil, errors.New("vault header truncated")
+	}
+
+	var h Header
+	if err := json.Unmarshal(data[prefixLen:prefixLen+hdrLen], &h); err != nil {
+		return nil, nil, nil, fmt.Errorf("corrupted vault header: %w", err)
+	}
+	h.Version = version
+
+	return &h, data[:prefixLen+hdrLen], data[prefixLen+hdrLen:], nil
+}
+
+func sealFile(h *Header, plaintext []byte, key []byte) ([]byte, error) {
+	ad, err := encodeHeader(h)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := crypto.EncryptWithAD(plaintext, key, ad)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(ad, ciphertext...), nil
+}
+
+// returns the payload and the format version it was written with
+// (0 for legacy files). the payload is in a SecureBuffer the caller destroys
+func openFile(data []byte, key []byte) (*crypto.SecureBuffer, uint8, error) {
+	if isLegacy(data) {
+		plaintext, err := crypto.DecryptSecure(data, key, nil)
+		return plaintext, 0, err
+	}
+
+	h, ad, body, err := decodeHeader(data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if h.Algorithm != AlgAES256GCM {
+		return nil, 0, fmt.Errorf("unsupported vault algorithm '%s'", h.Algorithm)
+	}
+	if h.KeyID != crypto.KeyID(key) {
+		return nil, 0, fmt.Errorf("%w (expected key id %s)", ErrKeyMismatch, h.KeyID)
+	}
+
+	plaintext, err := crypto.DecryptSecure(body, key, ad)
+	return plaintext, h.Version, err
+}
+
+// reads just the header of a vault without decrypting it.
+// returns ErrLegacyFormat for headerless files
+func ReadHeader(path string) (*Header, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseHeader(data)
+}
+
+// same as ReadHeader for a vault that is already in memory
+func ParseHeader(data []byte) (*Header, error) {
+	if isLegacy(data) {
+		return nil, ErrLegacyFormat
+	}
+
+	h, _, _, err := decodeHeader(data)
+	return h, err
+}
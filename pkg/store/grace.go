@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+)
+
+// keeps a retired master key working until Expires by storing the current
+// vault key encrypted under it. written by 'cloak rotate --grace'. the entry
+// is dropped from the header once it expires, but older copies of the file
+// still hold it: a key that was ever wrapped here is only as safe as the old
+// one, so it has to be rotated again (without grace) afterwards
+type GraceKey struct {
+	KeyID      string    `json:"kid"`
+	WrappedKey []byte    `json:"key"`
+	Expires    time.Time `json:"expires"`
+}
+
+var ErrKeyMismatch = errors.New("master key does not match this vault")
+
+func (h *Header) AddGraceKey(oldKeyHex, newKeyHex string, expires time.Time) error {
+	oldKey, err := hex.DecodeString(oldKeyHex)
+	if err != nil {
+		return fmt.Errorf("invalid key format: %w", err)
+	}
+	newKey, err := hex.DecodeString(newKeyHex)
+	if err != nil {
+		return fmt.Errorf("invalid key format: %w", err)
+	}
+
+	wrapped, err := crypto.Encrypt(newKey, oldKey)
+	if err != nil {
+		return err
+	}
+
+	h.Grace = append(h.Grace, GraceKey{
+		KeyID:      crypto.KeyID(oldKey),
+		WrappedKey: wrapped,
+		Expires:    expires.UTC(),
+	})
+	return nil
+}
+
+// maps a master key to the current vault key. a key that already matches
+// is returned as-is; a retired key still inside its grace period is
+// exchanged for the current one
+func (h *Header) ResolveKey(keyHex string) (string, *GraceKey, error) {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid key format: %w", err)
+	}
+
+	kid := crypto.KeyID(key)
+	if kid == h.KeyID {
+		return keyHex, nil, nil
+	}
+
+	for i, g := range h.Grace {
+		if g.KeyID != kid {
+			continue
+		}
+		if time.Now().After(g.Expires) {
+			return "", nil, fmt.Errorf("master key was rotated and its grace period ended %s", g.Expires.Local().Format(time.RFC1123))
+		}
+
+		current, err := crypto.Decrypt(g.WrappedKey, key)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to unwrap rotated key: %w", err)
+		}
+		if crypto.KeyID(current) != h.KeyID {
+			return "", nil, errors.New("grace entry does not match the vault key")
+		}
+		return hex.EncodeToString(current), &h.Grace[i], nil
+	}
+
+	return "", nil, ErrKeyMismatch
+}
+
+func activeGraceKeys(keys []GraceKey) []GraceKey {
+	var active []GraceKey
+	for _, g := range keys {
+		if time.Now().Before(g.Expires) {
+			active = append(active, g)
+		}
+	}
+	return active
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+)
+
+func mustKey(t *testing.T) string {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// rotates a vault at path to a new key with a grace entry expiring at
+// expires, then saves it once more the way every other command does
+func rotateWithGrace(t *testing.T, path string, expires time.Time) (oldKey, newKey string) {
+	t.Helper()
+	oldKey, newKey = mustKey(t), mustKey(t)
+
+	vault := NewVault()
+	vault.Environments[DefaultEnv].Set("A", "1", "test", time.Now())
+
+	h := &Header{}
+	if err := h.AddGraceKey(oldKey, newKey, expires); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveWithHeader(path, vault, newKey, h); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(path, vault, newKey); err != nil {
+		t.Fatal(err)
+	}
+	return oldKey, newKey
+}
+
+func TestGraceKeyDroppedAfterExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloak.encrypted")
+	oldKey, _ := rotateWithGrace(t, path, time.Now().Add(-time.Minute))
+
+	h, err := ReadHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Grace) != 0 {
+		t.Fatalf("header written after the grace period still carries %d wrapped key(s)", len(h.Grace))
+	}
+	if _, _, err := h.ResolveKey(oldKey); err == nil {
+		t.Fatal("old key still resolves after the grace period")
+	}
+}
+
+func TestGraceKeyKeptWhileActive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloak.encrypted")
+	oldKey, newKey := rotateWithGrace(t, path, time.Now().Add(time.Hour))
+
+	h, err := ReadHeader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Grace) != 1 {
+		t.Fatalf("header carries %d grace entries, want 1", len(h.Grace))
+	}
+
+	resolved, g, err := h.ResolveKey(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != newKey || g == nil {
+		t.Fatalf("old key resolved to %s, want the new key", resolved)
+	}
+}
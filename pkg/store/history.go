@@ -0,0 +1,79 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// a previous value of a secret, with who set it and when
+type Version struct {
+	Value      string    `json:"value"`
+	Updated    time.Time `json:"updated,omitzero"`
+	ModifiedBy string    `json:"by,omitempty"`
+}
+
+// previous values of a key, newest first. version N is HistoryOf(key)[N-1]
+func (e *Environment) HistoryOf(key string) []Version {
+	return e.History[key]
+}
+
+// puts a key back to version n (1 is the value before the current one).
+// the value it replaces goes into history like any other change
+func (e *Environment) Rollback(key string, n int, author string, now time.Time) error {
+	versions := e.History[key]
+	if n < 1 || n > len(versions) {
+		return fmt.Errorf("%s has no version %d (%d kept)", key, n, len(versions))
+	}
+	e.Set(key, versions[n-1].Value, author, now)
+	return nil
+}
+
+// called before a key's value is replaced or removed
+func (e *Environment) record(key string) {
+	value, ok := e.Secrets[key]
+	if !ok {
+		return
+	}
+	if e.History == nil {
+		e.History = make(map[string][]Version)
+	}
+
+	m := e.MetaOf(key)
+	v := Version{Value: value, Updated: m.Updated, ModifiedBy: m.ModifiedBy}
+	e.History[key] = append([]Version{v}, e.History[key]...)
+}
+
+// keeps at most depth versions per key; 0 drops history altogether
+func (e *Environment) trimHistory(depth int) {
+	for k, versions := range e.History {
+		if len(versions) > depth {
+			versions = versions[:depth]
+		}
+		if len(versions) == 0 {
+			delete(e.History, k)
+			continue
+		}
+		e.History[k] = versions
+	}
+	if len(e.History) == 0 {
+		e.History = nil
+	}
+}
+
+// union of both sides' histories, newest first
+func mergeHistory(a, b []Version) []Version {
+	out := slices.Clone(a)
+	for _, v := range b {
+		if !slices.ContainsFunc(out, func(x Version) bool {
+			return x.Value == v.Value && x.Updated.Equal(v.Updated) && x.ModifiedBy == v.ModifiedBy
+		}) {
+			out = append(out, v)
+		}
+	}
+	slices.SortStableFunc(out, func(x, y Version) int {
+		return cmp.Compare(y.Updated.UnixNano(), x.Updated.UnixNano())
+	})
+	return out
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrLocked = errors.New("vault is locked by another cloak process")
+
+// how often Lock retries while someone else holds the lock
+const lockPoll = 50 * time.Millisecond
+
+// advisory lock guarding a load-modify-save cycle on a vault. it only
+// excludes other cloak processes that take it too; readers never need it
+// since writes are atomic renames
+type Lock struct {
+	release func() error
+}
+
+// blocks until the lock for the vault at path is free or timeout passes,
+// in which case it returns ErrLocked
+func LockFile(path string, timeout time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		release, err := tryLock(path)
+		if err == nil {
+			return &Lock{release: release}, nil
+		}
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+func (l *Lock) Unlock() error {
+	return l.release()
+}
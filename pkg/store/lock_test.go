@@ -0,0 +1,126 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// what every cloak command that writes does: lock, load, change, save
+func lockedSet(path, key, k, v string) error {
+	lock, err := LockFile(path, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	vault, err := Load(path, key)
+	if err != nil {
+		return err
+	}
+	vault.Environments[DefaultEnv].Set(k, v, "test", time.Now())
+	return Save(path, vault, key)
+}
+
+func TestConcurrentSets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cloak.encrypted")
+	key := mustKey(t)
+	if err := Save(path, NewVault(), key); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- lockedSet(path, key, fmt.Sprintf("KEY_%d", i), "value")
+		}()
+	}
+
+	// readers don't lock, and must never see a half-written vault
+	done := make(chan struct{})
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-done:
+				readErr <- nil
+				return
+			default:
+			}
+			if _, err := Load(path, key); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(done)
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := <-readErr; err != nil {
+		t.Fatalf("reader saw a broken vault: %v", err)
+	}
+
+	vault, err := Load(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets, err := vault.Resolve(DefaultEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != writers {
+		t.Fatalf("got %d keys, want %d: some sets were lost", len(secrets), writers)
+	}
+
+	// no temp files left next to the vault
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "cloak.encrypted" {
+			t.Errorf("leftover file %s", e.Name())
+		}
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cloak.encrypted")
+
+	held, err := LockFile(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := LockFile(path, 200*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got %v, want ErrLocked while the lock is held", err)
+	}
+	if waited := time.Since(start); waited < 200*time.Millisecond {
+		t.Fatalf("gave up after %s, before the timeout", waited)
+	}
+
+	if err := held.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := LockFile(path, time.Second)
+	if err != nil {
+		t.Fatalf("lock not free after Unlock: %v", err)
+	}
+	again.Unlock()
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// a key (or an environment's inheritance when Key is empty) that was
+// changed differently on both sides. nil values mean "absent"
+type Conflict struct {
+	Env    string
+	Key    string
+	Base   *string
+	Ours   *string
+	Theirs *string
+}
+
+// three-way merge of two vaults that share a common ancestor.
+// non-conflicting changes from both sides are combined; conflicts are
+// resolved in favour of ours and reported so the caller can fix them up
+func Merge(base, ours, theirs *Vault) (*Vault, []Conflict, error) {
+	merged := &Vault{Environments: make(map[string]*Environment), HistoryDepth: ours.HistoryDepth}
+	if ours.HistoryDepth == base.HistoryDepth {
+		merged.HistoryDepth = theirs.HistoryDepth
+	}
+	var conflicts []Conflict
+
+	names := make(map[string]bool)
+	for _, v := range []*Vault{base, ours, theirs} {
+		for name := range v.Environments {
+			names[name] = true
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		env, envConflicts, err := mergeEnv(name, base.Environments[name], ours.Environments[name], theirs.Environments[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		if env != nil {
+			merged.Environments[name] = env
+		}
+		conflicts = append(conflicts, envConflicts...)
+	}
+
+	return merged, conflicts, nil
+}
+
+func mergeEnv(name string, b, o, t *Environment) (*Environment, []Conflict, error) {
+	// an environment deleted on one side and untouched on the other stays deleted
+	switch {
+	case o == nil && t == nil:
+		return nil, nil, nil
+	case o == nil && envEqual(b, t), t == nil && envEqual(b, o):
+		return nil, nil, nil
+	}
+
+	for _, env := range []*Environment{b, o, t} {
+		if env != nil && env.Locked() {
+			return mergeSealed(name, b, o, t)
+		}
+	}
+
+	result := &Environment{name: name, Secrets: make(EncryptedStore)}
+	for _, env := range []*Environment{o, t} {
+		if env != nil && env.KeyID != "" {
+			result.KeyID = env.KeyID
+			result.key = env.key
+			break
+		}
+	}
+
+	var conflicts []Conflict
+
+	inherits, ok := merge3(field(b, inheritsOf), field(o, inheritsOf), field(t, inheritsOf))
+	if !ok {
+		conflicts = append(conflicts, Conflict{Env: name, Base: field(b, inheritsOf), Ours: field(o, inheritsOf), Theirs: field(t, inheritsOf)})
+	}
+	if inherits != nil {
+		result.Inherits = *inherits
+	}
+
+	keys := make(map[string]bool)
+	for _, env := range []*Environment{b, o, t} {
+		if env != nil {
+			for k := range env.Secrets {
+				keys[k] = true
+			}
+		}
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(keys)) {
+		bv, ov, tv := lookup(b, k), lookup(o, k), lookup(t, k)
+		value, ok := merge3(bv, ov, tv)
+		if !ok {
+			conflicts = append(conflicts, Conflict{Env: name, Key: k, Base: bv, Ours: ov, Theirs: tv})
+		}
+		if value != nil {
+			result.Secrets[k] = *value
+			if m := mergeMeta(k, *value, b, o, t); m != nil {
+				if result.Meta == nil {
+					result.Meta = make(map[string]*SecretMeta)
+				}
+				result.Meta[k] = m
+			}
+		}
+	}
+
+	for _, env := range []*Environment{o, t} {
+		if env == nil {
+			continue
+		}
+		for k, versions := range env.History {
+			if result.History == nil {
+				result.History = make(map[string][]Version)
+			}
+			result.History[k] = mergeHistory(result.History[k], versions)
+		}
+	}
+
+	return result, conflicts, nil
+}
+
+// metadata follows the value that won. when both sides hold that value,
+// the more recent update wins, then whichever side edited the description or tags
+func mergeMeta(key, value string, b, o, t *Environment) *SecretMeta {
+	var candidates []*SecretMeta
+	for _, env := range []*Environment{o, t} {
+		if v := lookup(env, key); v != nil && *v == value && env.Meta[key] != nil {
+			candidates = append(candidates, env.Meta[key])
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0]
+	}
+
+	ours, theirs := candidates[0], candidates[1]
+	switch {
+	case theirs.Updated.After(ours.Updated):
+		return theirs
+	case ours.Updated.After(theirs.Updated):
+		return ours
+	case b != nil && metaEqual(b.Meta[key], ours):
+		return theirs
+	}
+	return ours
+}
+
+// environments sealed with a key we don't have can only be merged as a
+// whole: take whichever side changed
+func mergeSealed(name string, b, o, t *Environment) (*Environment, []Conflict, error) {
+	switch {
+	case sealedEqual(o, t), sealedEqual(b, t):
+		return o, nil, nil
+	case sealedEqual(b, o):
+		return t, nil, nil
+	}
+	return nil, nil, fmt.Errorf("environment '%s' is sealed and changed on both sides; provide its key to merge it", name)
+}
+
+// classic three-way rule: identical sides or a one-sided change merge cleanly
+func merge3(base, ours, theirs *string) (*string, bool) {
+	switch {
+	case strEqual(ours, theirs):
+		return ours, true
+	case strEqual(base, ours):
+		return theirs, true
+	case strEqual(base, theirs):
+		return ours, true
+	}
+	return ours, false
+}
+
+func lookup(env *Environment, key string) *string {
+	if env == nil {
+		return nil
+	}
+	v, ok := env.Secrets[key]
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+func inheritsOf(env *Environment) string {
+	return env.Inherits
+}
+
+func field(env *Environment, get func(*Environment) string) *string {
+	if env == nil {
+		return nil
+	}
+	v := get(env)
+	return &v
+}
+
+func strEqual(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func envEqual(a, b *Environment) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Locked() || b.Locked() {
+		return sealedEqual(a, b)
+	}
+	return a.Inherits == b.Inherits && maps.Equal(a.Secrets, b.Secrets)
+}
+
+func metaEqual(a, b *SecretMeta) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Created.Equal(b.Created) && a.Updated.Equal(b.Updated) && a.ModifiedBy == b.ModifiedBy &&
+		a.Description == b.Description && slices.Equal(a.Tags, b.Tags)
+}
+
+func sealedEqual(a, b *Environment) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Inherits == b.Inherits && a.KeyID == b.KeyID && bytes.Equal(a.Sealed, b.Sealed)
+}
+
+// three-way merge of the headers that go with Merge. recipients added or
+// removed on either side are combined; both sides have to be encrypted under
+// the same vault key, since a rotation on one branch can't be merged.
+// legacy files have no header and are passed as an empty one
+func MergeHeaders(base, ours, theirs *Header) (*Header, error) {
+	if ours.KeyID != "" && theirs.KeyID != "" && ours.KeyID != theirs.KeyID {
+		return nil, fmt.Errorf("the vault key was changed on one side (%s vs %s): merge before rotating", ours.KeyID, theirs.KeyID)
+	}
+
+	merged := *ours
+	if merged.KDF == nil {
+		merged.KDF = theirs.KDF
+	}
+
+	has := func(h *Header, pub string) bool {
+		return slices.ContainsFunc(h.Recipients, func(r Recipient) bool { return r.PublicKey == pub })
+	}
+	merged.Recipients = nil
+	for _, r := range ours.Recipients {
+		// kept unless the other side removed it
+		if has(theirs, r.PublicKey) || !has(base, r.PublicKey) {
+			merged.Recipients = append(merged.Recipients, r)
+		}
+	}
+	for _, r := range theirs.Recipients {
+		if !has(ours, r.PublicKey) && !has(base, r.PublicKey) {
+			merged.Recipients = append(merged.Recipients, r)
+		}
+	}
+
+	merged.Grace = activeGraceKeys(ours.Grace)
+	for _, g := range activeGraceKeys(theirs.Grace) {
+		if !slices.ContainsFunc(merged.Grace, func(o GraceKey) bool { return o.KeyID == g.KeyID }) {
+			merged.Grace = append(merged.Grace, g)
+		}
+	}
+
+	return &merged, nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func recipientKeys(h *Header) []string {
+	var keys []string
+	for _, r := range h.Recipients {
+		keys = append(keys, r.PublicKey)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestMergeHeadersRecipients(t *testing.T) {
+	header := func(pubs ...string) *Header {
+		h := &Header{KeyID: "k"}
+		for _, p := range pubs {
+			h.Recipients = append(h.Recipients, Recipient{PublicKey: p})
+		}
+		return h
+	}
+
+	tests := []struct {
+		name               string
+		base, ours, theirs *Header
+		want               []string
+	}{
+		{"added on both sides", header("a"), header("a", "b"), header("a", "c"), []string{"a", "b", "c"}},
+		{"removed by them", header("a", "b"), header("a", "b"), header("a"), []string{"a"}},
+		{"removed by us", header("a", "b"), header("b"), header("a", "b"), []string{"b"}},
+		{"removed by us, added by them", header("a"), header(), header("a", "b"), []string{"b"}},
+		{"no base", &Header{}, header("a"), header("a", "b"), []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeHeaders(tt.base, tt.ours, tt.theirs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := recipientKeys(merged); !slices.Equal(got, tt.want) {
+				t.Errorf("recipients = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeHeadersKeyChanged(t *testing.T) {
+	if _, err := MergeHeaders(&Header{KeyID: "a"}, &Header{KeyID: "a"}, &Header{KeyID: "b"}); err == nil {
+		t.Fatal("expected an error when the vault key differs between sides")
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// bookkeeping kept next to each secret, inside the encrypted payload
+type SecretMeta struct {
+	Created     time.Time `json:"created,omitzero"`
+	Updated     time.Time `json:"updated,omitzero"`
+	ModifiedBy  string    `json:"by,omitempty"`
+	Description string    `json:"desc,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+}
+
+// sets a secret and records who changed it and when, moving the old value
+// into history. setting a key to the value it already has changes nothing
+func (e *Environment) Set(key, value, author string, now time.Time) {
+	old, exists := e.Secrets[key]
+	if exists && old == value {
+		return
+	}
+	e.record(key)
+	e.Secrets[key] = value
+
+	m := e.metaFor(key)
+	if !exists || m.Created.IsZero() {
+		m.Created = now
+	}
+	m.Updated = now
+	m.ModifiedBy = author
+}
+
+// removes a secret. its last value stays in history so it can be rolled back
+func (e *Environment) Unset(key string) {
+	e.record(key)
+	delete(e.Secrets, key)
+	delete(e.Meta, key)
+}
+
+// replaces the whole set of secrets (e.g. after an editor session),
+// stamping keys that were added or changed
+func (e *Environment) Replace(secrets EncryptedStore, author string, now time.Time) {
+	for k := range e.Secrets {
+		if _, ok := secrets[k]; !ok {
+			e.Unset(k)
+		}
+	}
+	for k, v := range secrets {
+		e.Set(k, v, author, now)
+	}
+}
+
+// updates the description and/or tags of an existing key. nil leaves a
+// field as it is, an empty tag clears the tags
+func (e *Environment) Describe(key string, description *string, tags []string) {
+	m := e.metaFor(key)
+	if description != nil {
+		m.Description = *description
+	}
+	if tags != nil {
+		tags = slices.DeleteFunc(slices.Clone(tags), func(t string) bool { return t == "" })
+		m.Tags = slices.Compact(slices.Sorted(slices.Values(tags)))
+	}
+}
+
+// metadata of a key; the zero value when nothing was recorded
+func (e *Environment) MetaOf(key string) SecretMeta {
+	if m, ok := e.Meta[key]; ok && m != nil {
+		return *m
+	}
+	return SecretMeta{}
+}
+
+func (e *Environment) metaFor(key string) *SecretMeta {
+	if e.Meta == nil {
+		e.Meta = make(map[string]*SecretMeta)
+	}
+	m, ok := e.Meta[key]
+	if !ok || m == nil {
+		m = &SecretMeta{}
+		e.Meta[key] = m
+	}
+	return m
+}
+
+// metadata for every key Resolve returns, taken from the environment the
+// value comes from
+func (v *Vault) ResolveMeta(name string) (map[string]SecretMeta, error) {
+	chain, err := v.Chain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]SecretMeta)
+	for i := len(chain) - 1; i >= 0; i-- {
+		env := v.Environments[chain[i]]
+		if env.Locked() {
+			return nil, fmt.Errorf("%w: '%s'", ErrEnvLocked, chain[i])
+		}
+		for k := range env.Secrets {
+			out[k] = env.MetaOf(k)
+		}
+	}
+	return out, nil
+}
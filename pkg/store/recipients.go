@@ -0,0 +1,83 @@
+package store
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+)
+
+var ErrNoMatchingRecipient = errors.New("no recipient entry matches this identity")
+
+// one envelope of the vault key, readable only by the holder of the
+// X25519 identity behind PublicKey
+type Recipient struct {
+	Name         string `json:"name,omitempty"`
+	PublicKey    string `json:"pub"`
+	EphemeralKey []byte `json:"epk"`
+	WrappedKey   []byte `json:"key"`
+}
+
+// wraps the vault key for the given public key. an existing entry for the
+// same key is replaced
+func (h *Header) AddRecipient(name, publicKey, keyHex string) error {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return fmt.Errorf("invalid key format: %w", err)
+	}
+
+	epk, wrapped, err := crypto.WrapKey(key, publicKey)
+	if err != nil {
+		return err
+	}
+
+	h.RemoveRecipient(publicKey)
+	h.Recipients = append(h.Recipients, Recipient{
+		Name:         name,
+		PublicKey:    publicKey,
+		EphemeralKey: epk,
+		WrappedKey:   wrapped,
+	})
+	return nil
+}
+
+// drops every entry whose public key or name matches.
+// returns the removed entries
+func (h *Header) RemoveRecipient(match string) []Recipient {
+	var kept, removed []Recipient
+	for _, r := range h.Recipients {
+		if r.PublicKey == match || (r.Name != "" && r.Name == match) {
+			removed = append(removed, r)
+			continue
+		}
+		kept = append(kept, r)
+	}
+	h.Recipients = kept
+	return removed
+}
+
+// recovers the vault key (hex) using the caller's identity
+func (h *Header) UnwrapKey(identity string) (string, error) {
+	publicKey, err := crypto.RecipientOf(identity)
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range h.Recipients {
+		if r.PublicKey != publicKey {
+			continue
+		}
+
+		key, err := crypto.UnwrapKey(r.EphemeralKey, r.WrappedKey, identity)
+		if err != nil {
+			return "", fmt.Errorf("failed to unwrap vault key: %w", err)
+		}
+		if crypto.KeyID(key) != h.KeyID {
+			return "", errors.New("recipient entry does not match the vault key")
+		}
+		return hex.EncodeToString(key), nil
+	}
+
+	return "", ErrNoMatchingRecipient
+}
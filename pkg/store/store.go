@@ -2,58 +2,139 @@ package store
 
 import (
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"os"
-
-	"github.com/atomisadev/cloak/pkg/crypto"
+	"path/filepath"
 )
 
 type EncryptedStore map[string]string
 
-func Load(path string, keyHex string) (EncryptedStore, error) {
+func readFile(path string) ([]byte, error) {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return nil, fmt.Errorf("store file '%s' not found", path)
 	}
 
-	key, err := hex.DecodeString(keyHex)
+	return os.ReadFile(path)
+}
+
+// decrypts the vault at path. older formats (legacy headerless files and
+// flat v1 stores) are still readable; they get upgraded to the current
+// format the next time they are saved
+func Load(path string, keyHex string) (*Vault, error) {
+	encryptedData, err := readFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("invalid key format: %w", err)
+		return nil, err
 	}
 
-	encryptedData, err := os.ReadFile(path)
+	return Decode(encryptedData, keyHex)
+}
+
+// same as Load for a vault that is already in memory (e.g. read from git)
+func Decode(encryptedData []byte, keyHex string) (*Vault, error) {
+	key, err := hex.DecodeString(keyHex)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid key format: %w", err)
 	}
 
-	jsonBytes, err := crypto.Decrypt(encryptedData, key)
+	plaintext, version, err := openFile(encryptedData, key)
+	clear(key)
 	if err != nil {
 		return nil, fmt.Errorf("decryption failed: %w", err)
 	}
+	// the vault gets its own copies of the values; the rest is wiped
+	defer plaintext.Destroy()
 
-	var store EncryptedStore
-	if err := json.Unmarshal(jsonBytes, &store); err != nil {
+	vault, err := decodeVault(version, plaintext.Bytes())
+	if err != nil {
 		return nil, fmt.Errorf("corrupted data store: %w", err)
 	}
 
-	return store, nil
+	return vault, nil
 }
 
-func Save(path string, data EncryptedStore, keyHex string) error {
+func Save(path string, vault *Vault, keyHex string) error {
 	key, err := hex.DecodeString(keyHex)
 	if err != nil {
 		return fmt.Errorf("invalid key format: %w", err)
 	}
 
-	jsonBytes, err := json.Marshal(data)
+	return save(path, vault, key, headerFor(path, key))
+}
+
+// like Save, but writes the given header settings instead of carrying
+// over the ones already on disk. used when creating or re-keying a vault
+func SaveWithHeader(path string, vault *Vault, keyHex string, h *Header) error {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return fmt.Errorf("invalid key format: %w", err)
+	}
+
+	h.bind(key)
+	return save(path, vault, key, h)
+}
+
+func save(path string, vault *Vault, key []byte, h *Header) error {
+	jsonBytes, err := vault.encode()
 	if err != nil {
 		return err
 	}
+	defer clear(jsonBytes)
 
-	encryptedData, err := crypto.Encrypt(jsonBytes, key)
+	encryptedData, err := sealFile(h, jsonBytes, key)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(path, encryptedData, 0644)
+	return writeFileAtomic(path, encryptedData, 0644)
+}
+
+// writes to a temp file next to path, fsyncs it and renames it into place,
+// so readers never see a half written vault and a crash leaves either the
+// old or the new one
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// reports the format version of the vault at path (0 for legacy files)
+// so callers can tell whether it needs 'cloak migrate'
+func FileVersion(path string) (uint8, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	if isLegacy(data) {
+		return 0, nil
+	}
+
+	h, _, _, err := decodeHeader(data)
+	if err != nil {
+		return 0, err
+	}
+	return h.Version, nil
 }
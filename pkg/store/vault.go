@@ -0,0 +1,273 @@
+package store
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/atomisadev/cloak/pkg/crypto"
+)
+
+const DefaultEnv = "default"
+
+var ErrEnvLocked = errors.New("environment is sealed with its own key")
+
+// decrypted contents of cloak.encrypted: a set of named environments
+type Vault struct {
+	Environments map[string]*Environment `json:"environments"`
+
+	// how many previous values to keep per key; 0 keeps none
+	HistoryDepth int `json:"history_depth,omitempty"`
+}
+
+type Environment struct {
+	// name of the environment this one extends. own keys win
+	Inherits string `json:"inherits,omitempty"`
+
+	// environments with their own key keep their secrets in Sealed,
+	// encrypted under that key. KeyID identifies the key
+	KeyID  string `json:"kid,omitempty"`
+	Sealed []byte `json:"sealed,omitempty"`
+
+	Secrets EncryptedStore         `json:"secrets,omitempty"`
+	Meta    map[string]*SecretMeta `json:"meta,omitempty"`
+	History map[string][]Version   `json:"history,omitempty"`
+
+	name string
+	key  []byte // set once a sealed environment has been unlocked
+}
+
+func NewVault() *Vault {
+	v := &Vault{Environments: make(map[string]*Environment)}
+	v.Environments[DefaultEnv] = &Environment{Secrets: make(EncryptedStore), name: DefaultEnv}
+	return v
+}
+
+// v1 vaults were a flat map; they become the default environment
+func decodeVault(version uint8, plaintext []byte) (*Vault, error) {
+	if version < 2 {
+		var secrets EncryptedStore
+		if err := json.Unmarshal(plaintext, &secrets); err != nil {
+			return nil, err
+		}
+		if secrets == nil {
+			secrets = make(EncryptedStore)
+		}
+		v := NewVault()
+		v.Environments[DefaultEnv].Secrets = secrets
+		return v, nil
+	}
+
+	var v Vault
+	if err := json.Unmarshal(plaintext, &v); err != nil {
+		return nil, err
+	}
+	if v.Environments == nil {
+		v.Environments = make(map[string]*Environment)
+	}
+	for name, env := range v.Environments {
+		env.name = name
+		if env.Secrets == nil && env.KeyID == "" {
+			env.Secrets = make(EncryptedStore)
+		}
+	}
+	return &v, nil
+}
+
+// re-seals unlocked environments; locked ones are written back untouched
+func (v *Vault) encode() ([]byte, error) {
+	out := Vault{Environments: make(map[string]*Environment, len(v.Environments)), HistoryDepth: v.HistoryDepth}
+
+	for name, env := range v.Environments {
+		if !env.Locked() {
+			env.trimHistory(v.HistoryDepth)
+		}
+
+		cp := *env
+		if env.KeyID != "" && env.key != nil {
+			sealed, err := env.seal()
+			if err != nil {
+				return nil, fmt.Errorf("failed to seal environment '%s': %w", name, err)
+			}
+			cp.Sealed = sealed
+			cp.Secrets = nil
+			cp.Meta = nil
+			cp.History = nil
+		}
+		out.Environments[name] = &cp
+	}
+
+	return json.Marshal(out)
+}
+
+func (v *Vault) EnvNames() []string {
+	return slices.Sorted(maps.Keys(v.Environments))
+}
+
+func (v *Vault) Env(name string) (*Environment, bool) {
+	env, ok := v.Environments[name]
+	return env, ok
+}
+
+// adds an empty environment. with keyHex set, its secrets are sealed
+// under that key instead of only the vault key
+func (v *Vault) CreateEnv(name, inherits, keyHex string) (*Environment, error) {
+	if name == "" {
+		return nil, errors.New("environment name cannot be empty")
+	}
+	if _, exists := v.Environments[name]; exists {
+		return nil, fmt.Errorf("environment '%s' already exists", name)
+	}
+	if inherits != "" {
+		if _, ok := v.Environments[inherits]; !ok {
+			return nil, fmt.Errorf("environment '%s' does not exist", inherits)
+		}
+	}
+
+	env := &Environment{Inherits: inherits, Secrets: make(EncryptedStore), name: name}
+	if keyHex != "" {
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key format: %w", err)
+		}
+		env.KeyID = crypto.KeyID(key)
+		env.key = key
+	}
+
+	v.Environments[name] = env
+	return env, nil
+}
+
+func (v *Vault) DeleteEnv(name string) error {
+	if name == DefaultEnv {
+		return errors.New("the default environment cannot be deleted")
+	}
+	if _, ok := v.Environments[name]; !ok {
+		return fmt.Errorf("environment '%s' does not exist", name)
+	}
+	for other, env := range v.Environments {
+		if env.Inherits == name {
+			return fmt.Errorf("environment '%s' inherits from '%s'", other, name)
+		}
+	}
+
+	delete(v.Environments, name)
+	return nil
+}
+
+// names of the environment and everything it inherits from, child first
+func (v *Vault) Chain(name string) ([]string, error) {
+	var chain []string
+	seen := make(map[string]bool)
+
+	for current := name; current != ""; {
+		if seen[current] {
+			return nil, fmt.Errorf("environment '%s' has an inheritance cycle", name)
+		}
+		seen[current] = true
+
+		env, ok := v.Environments[current]
+		if !ok {
+			return nil, fmt.Errorf("environment '%s' does not exist", current)
+		}
+		chain = append(chain, current)
+		current = env.Inherits
+	}
+
+	return chain, nil
+}
+
+// flattens an environment and its parents into the final set of secrets
+func (v *Vault) Resolve(name string) (EncryptedStore, error) {
+	chain, err := v.Chain(name)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(EncryptedStore)
+	for i := len(chain) - 1; i >= 0; i-- {
+		env := v.Environments[chain[i]]
+		if env.Locked() {
+			return nil, fmt.Errorf("%w: '%s'", ErrEnvLocked, chain[i])
+		}
+		maps.Copy(out, env.Secrets)
+	}
+	return out, nil
+}
+
+// true for sealed environments whose key hasn't been supplied yet
+func (e *Environment) Locked() bool {
+	return e.KeyID != "" && e.key == nil
+}
+
+func (e *Environment) Unlock(keyHex string) error {
+	if !e.Locked() {
+		return nil
+	}
+
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return fmt.Errorf("invalid key format: %w", err)
+	}
+	if crypto.KeyID(key) != e.KeyID {
+		return fmt.Errorf("%w (expected key id %s)", ErrKeyMismatch, e.KeyID)
+	}
+
+	var payload sealedPayload
+	if len(e.Sealed) > 0 {
+		plaintext, err := crypto.DecryptSecure(e.Sealed, key, e.ad())
+		if err != nil {
+			return err
+		}
+		payload, err = decodeSealed(plaintext.Bytes())
+		plaintext.Destroy()
+		if err != nil {
+			return fmt.Errorf("corrupted environment: %w", err)
+		}
+	}
+	if payload.Secrets == nil {
+		payload.Secrets = make(EncryptedStore)
+	}
+
+	e.Secrets = payload.Secrets
+	e.Meta = payload.Meta
+	e.History = payload.History
+	e.key = key
+	return nil
+}
+
+// what a sealed environment encrypts under its own key
+type sealedPayload struct {
+	Secrets EncryptedStore         `json:"secrets"`
+	Meta    map[string]*SecretMeta `json:"meta,omitempty"`
+	History map[string][]Version   `json:"history,omitempty"`
+}
+
+// v2 vaults sealed the bare secrets map
+func decodeSealed(plaintext []byte) (sealedPayload, error) {
+	var payload sealedPayload
+	if err := json.Unmarshal(plaintext, &payload); err == nil && payload.Secrets != nil {
+		return payload, nil
+	}
+
+	payload = sealedPayload{}
+	err := json.Unmarshal(plaintext, &payload.Secrets)
+	return payload, err
+}
+
+func (e *Environment) seal() ([]byte, error) {
+	plaintext, err := json.Marshal(sealedPayload{Secrets: e.Secrets, Meta: e.Meta, History: e.History})
+	if err != nil {
+		return nil, err
+	}
+	defer clear(plaintext)
+	return crypto.EncryptWithAD(plaintext, e.key, e.ad())
+}
+
+// binds the sealed blob to the environment name so it can't be swapped
+func (e *Environment) ad() []byte {
+	return []byte("cloak/env/" + e.name)
+}
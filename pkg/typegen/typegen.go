@@ -0,0 +1,237 @@
+package typegen
+
+import (
+	"fmt"
+	"go/format"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const header = "Code generated by cloak types. DO NOT EDIT."
+
+type Options struct {
+	// package name for Go output
+	Package string
+}
+
+// languages supported by Generate, with the file each one writes by default
+var DefaultFiles = map[string]string{
+	"ts":     "env.d.ts",
+	"python": "config.py",
+	"go":     "env.go",
+	"rust":   "env.rs",
+}
+
+// renders type definitions for the given environment variable names.
+// only names go in, never values
+func Generate(lang string, keys []string, opts Options) ([]byte, error) {
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+
+	switch lang {
+	case "ts":
+		return generateTS(keys), nil
+	case "python":
+		return generatePython(keys)
+	case "go":
+		return generateGo(keys, opts)
+	case "rust":
+		return generateRust(keys)
+	}
+	return nil, fmt.Errorf("unsupported language '%s' (use ts, python, go or rust)", lang)
+}
+
+func generateTS(keys []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n\n", header)
+	b.WriteString("declare global {\n  namespace NodeJS {\n    interface ProcessEnv {\n")
+	for _, k := range keys {
+		name := k
+		if !isIdentifier(k) {
+			name = fmt.Sprintf("%q", k)
+		}
+		fmt.Fprintf(&b, "      %s: string;\n", name)
+	}
+	b.WriteString("    }\n  }\n}\n\nexport {};\n")
+	return []byte(b.String())
+}
+
+var pythonKeywords = []string{
+	"False", "None", "True", "and", "as", "assert", "async", "await", "break", "class", "continue",
+	"def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import",
+	"in", "is", "lambda", "nonlocal", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield",
+}
+
+func generatePython(keys []string) ([]byte, error) {
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		// pydantic treats names starting with _ as private attributes, not fields
+		if isIdentifier(k) && !strings.HasPrefix(k, "_") && !slices.Contains(pythonKeywords, k) {
+			fields[i] = k
+			continue
+		}
+		fields[i] = snakeCase(k)
+		switch {
+		case strings.HasPrefix(fields[i], "_"):
+			fields[i] = "field" + fields[i]
+		case slices.Contains(pythonKeywords, fields[i]):
+			fields[i] += "_"
+		}
+	}
+	if err := checkUnique(keys, fields); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", header)
+	b.WriteString("from pydantic import Field\nfrom pydantic_settings import BaseSettings\n\n\n")
+	b.WriteString("class Settings(BaseSettings):\n")
+	if len(keys) == 0 {
+		b.WriteString("    pass\n")
+	}
+	for i, k := range keys {
+		if fields[i] == k {
+			fmt.Fprintf(&b, "    %s: str\n", k)
+			continue
+		}
+		fmt.Fprintf(&b, "    %s: str = Field(alias=%q)\n", fields[i], k)
+	}
+	return []byte(b.String()), nil
+}
+
+func generateGo(keys []string, opts Options) ([]byte, error) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "env"
+	}
+
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		fields[i] = camelCase(k)
+	}
+	if err := checkUnique(keys, fields); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n\npackage %s\n\n", header, pkg)
+	b.WriteString("import (\n\"fmt\"\n\"os\"\n)\n\n")
+
+	b.WriteString("// Env holds the variables injected by cloak run.\ntype Env struct {\n")
+	for i, k := range keys {
+		fmt.Fprintf(&b, "%s string `env:%q`\n", fields[i], k)
+	}
+	b.WriteString("}\n\n")
+
+	b.WriteString("// Load reads Env from the process environment and fails if any variable is missing.\n")
+	b.WriteString("func Load() (*Env, error) {\nvar missing []string\n")
+	b.WriteString("get := func(key string) string {\nv, ok := os.LookupEnv(key)\nif !ok {\nmissing = append(missing, key)\n}\nreturn v\n}\n\n")
+	b.WriteString("e := &Env{\n")
+	for i, k := range keys {
+		fmt.Fprintf(&b, "%s: get(%q),\n", fields[i], k)
+	}
+	b.WriteString("}\nif len(missing) > 0 {\nreturn nil, fmt.Errorf(\"missing environment variables: %v\", missing)\n}\nreturn e, nil\n}\n")
+
+	return format.Source([]byte(b.String()))
+}
+
+// keywords (and reserved words) that can be used as r#raw identifiers
+var rustKeywords = []string{
+	"abstract", "as", "async", "await", "become", "box", "break", "const", "continue", "do", "dyn",
+	"else", "enum", "extern", "false", "final", "fn", "for", "gen", "if", "impl", "in", "let", "loop",
+	"macro", "match", "mod", "move", "mut", "override", "priv", "pub", "ref", "return", "static",
+	"struct", "trait", "true", "try", "type", "typeof", "unsafe", "unsized", "use", "virtual", "where",
+	"while", "yield",
+}
+
+// keywords that can't be raw identifiers; they get a trailing _ instead
+var rustPathKeywords = []string{"crate", "self", "Self", "super", "_"}
+
+func generateRust(keys []string) ([]byte, error) {
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		fields[i] = snakeCase(k)
+		switch {
+		case slices.Contains(rustPathKeywords, fields[i]):
+			fields[i] += "_"
+		case slices.Contains(rustKeywords, fields[i]):
+			fields[i] = "r#" + fields[i]
+		}
+	}
+	if err := checkUnique(keys, fields); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n\n", header)
+	b.WriteString("/// Variables injected by `cloak run`.\n#[derive(Debug, Clone)]\npub struct Env {\n")
+	for _, f := range fields {
+		fmt.Fprintf(&b, "    pub %s: String,\n", f)
+	}
+	b.WriteString("}\n\nimpl Env {\n")
+	b.WriteString("    /// Reads every variable from the process environment.\n")
+	b.WriteString("    pub fn from_env() -> Result<Self, String> {\n")
+	b.WriteString("        fn var(key: &str) -> Result<String, String> {\n")
+	b.WriteString("            std::env::var(key).map_err(|_| format!(\"missing environment variable {key}\"))\n")
+	b.WriteString("        }\n\n        Ok(Self {\n")
+	for i, k := range keys {
+		fmt.Fprintf(&b, "            %s: var(%q)?,\n", fields[i], k)
+	}
+	b.WriteString("        })\n    }\n}\n")
+	return []byte(b.String()), nil
+}
+
+// fails when two keys map to the same field name (DB_URL and db-url are
+// both DbUrl in Go), which would generate code that doesn't compile
+func checkUnique(keys, fields []string) error {
+	seen := make(map[string]string, len(fields))
+	for i, f := range fields {
+		if other, ok := seen[f]; ok {
+			return fmt.Errorf("keys '%s' and '%s' would both become '%s'; rename one of them", other, keys[i], f)
+		}
+		seen[f] = keys[i]
+	}
+	return nil
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if r == '_' || r <= unicode.MaxASCII && unicode.IsLetter(r) || i > 0 && r <= unicode.MaxASCII && unicode.IsDigit(r) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !(r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)))
+	})
+}
+
+// DATABASE_URL -> DatabaseUrl
+func camelCase(s string) string {
+	var b strings.Builder
+	for _, w := range words(s) {
+		b.WriteString(strings.ToUpper(w[:1]) + strings.ToLower(w[1:]))
+	}
+	name := b.String()
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "X" + name
+	}
+	return name
+}
+
+// DATABASE-URL -> database_url
+func snakeCase(s string) string {
+	name := strings.ToLower(strings.Join(words(s), "_"))
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
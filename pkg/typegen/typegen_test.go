@@ -0,0 +1,93 @@
+package typegen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateNaming(t *testing.T) {
+	tests := []struct {
+		lang string
+		keys []string
+		want []string
+	}{
+		{"ts", []string{"API_KEY", "my-key", "1PASSWORD"}, []string{
+			"      API_KEY: string;",
+			`      "my-key": string;`,
+			`      "1PASSWORD": string;`,
+		}},
+		{"python", []string{"API_KEY", "my-key"}, []string{
+			"    API_KEY: str\n",
+			`    my_key: str = Field(alias="my-key")`,
+		}},
+		{"python", []string{"class", "None"}, []string{
+			`    class_: str = Field(alias="class")`,
+			`    none: str = Field(alias="None")`,
+		}},
+		{"python", []string{"_SECRET", "1PASSWORD_TOKEN", "__"}, []string{
+			`    secret: str = Field(alias="_SECRET")`,
+			`    field_1password_token: str = Field(alias="1PASSWORD_TOKEN")`,
+			`    field_: str = Field(alias="__")`,
+		}},
+		{"go", []string{"DATABASE_URL", "1PASSWORD", "type"}, []string{
+			"DatabaseUrl string `env:\"DATABASE_URL\"`",
+			"X1password  string `env:\"1PASSWORD\"`",
+			"Type        string `env:\"type\"`",
+		}},
+		{"rust", []string{"DATABASE_URL", "type", "self", "_"}, []string{
+			"    pub database_url: String,",
+			"    pub r#type: String,",
+			"    pub self_: String,",
+			"    pub __: String,",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang+"/"+strings.Join(tt.keys, ","), func(t *testing.T) {
+			out, err := Generate(tt.lang, tt.keys, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(out), w) {
+					t.Errorf("output is missing %q:\n%s", w, out)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateCollisions(t *testing.T) {
+	tests := []struct {
+		lang string
+		keys []string
+	}{
+		{"python", []string{"my-key", "my.key"}},
+		{"python", []string{"class", "class_"}},
+		{"go", []string{"DB_URL", "db-url"}},
+		{"rust", []string{"DB_URL", "db_url"}},
+		{"rust", []string{"self", "self_"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang+"/"+strings.Join(tt.keys, ","), func(t *testing.T) {
+			_, err := Generate(tt.lang, tt.keys, Options{})
+			if err == nil || !strings.Contains(err.Error(), "would both become") {
+				t.Fatalf("got %v, want a collision error", err)
+			}
+		})
+	}
+}
+
+func TestGenerateNoCollisionWhenQuoted(t *testing.T) {
+	// TypeScript quotes names instead of renaming them, so nothing can clash
+	if _, err := Generate("ts", []string{"DB_URL", "db-url", "db.url"}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateUnsupported(t *testing.T) {
+	if _, err := Generate("java", []string{"A"}, Options{}); err == nil {
+		t.Fatal("expected an error for an unsupported language")
+	}
+}